@@ -2,7 +2,10 @@ package argsp
 
 import (
 	"flag"
+	"fmt"
 	"reflect"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
 )
 
 type stringSlice []string
@@ -12,11 +15,25 @@ func (str *stringSlice) String() string {
 }
 
 func (str *stringSlice) Set(value string) error {
-	println(value)
 	*str = append(*str, value)
 	return nil
 }
 
+// commandLineFlags are taken from the command line over saved arguments,
+// so they can be changed for a run without saving arguments again
+var commandLineFlags = []string{
+	"watchinterval", "watchsettle",
+	"rollback",
+	"window", "windowlength", "windowmin",
+	"sqllock",
+	"archive", "archivekeep", "archivedays", "archiveapplied",
+	"order",
+	"historytable",
+	"importtimeout", "compiletimeout",
+	"failpattern",
+	"compile",
+}
+
 // ArgumentOptions provides argument parameters
 type ArgumentOptions struct {
 	ProjectName string
@@ -50,6 +67,49 @@ type ArgumentOptions struct {
 	// E.g the first installation was failed.
 	// So it is not necessary to make backup from brocken database
 	SkipBackup bool
+	// DryRun walks through the installation and prints the plan
+	// without touching services, the database or replication files
+	DryRun bool
+	// Resume continues the previous run from the last completed step
+	// written to the journal. The backup is skipped if it was made before.
+	Resume bool
+	// Rollback restores the backup made before the installation
+	// if any replication fails to import
+	Rollback bool
+	// SQLLock takes sp_getapplock to serialize loaders of different hosts
+	// installing replications to the same database
+	SQLLock bool
+	// Force imports replications again even if the history says they are applied
+	Force bool
+	// HistoryTable keeps the history of applied replications in the target database too
+	HistoryTable bool
+	// timeouts of tools in minutes, 0 means no limit
+	ImportTimeout      int
+	CompilationTimeout int
+	// FailPatterns fail the run if the output of a tool matches them
+	FailPatterns stringSlice
+	// Order is the strategy of ordering replications: mtime, sequence or dependency
+	Order string
+	// Compile is the policy of the compilation after imports: always, onimports or never
+	Compile string
+
+	// archive of processed replications
+	ArchiveMode string
+	ArchiveKeep int
+	ArchiveDays int
+	// ArchiveApplied removes or archives replications skipped as already applied,
+	// otherwise they are left in the replication directory
+	ArchiveApplied bool
+
+	// maintenance windows
+	MaintenanceWindows stringSlice
+	WindowLength       int
+	WindowMinRemaining int
+
+	// watch mode
+	Watch         bool
+	WatchInterval int
+	WatchSettle   int
 
 	// interactive mode
 	UseInteractive bool
@@ -63,47 +123,177 @@ func (args ArgumentOptions) IsEmpty() bool {
 	return reflect.DeepEqual(args, empty)
 }
 
+// Secrets returns passwords which have to be masked in the log, the console and emails
+func (args ArgumentOptions) Secrets() []string {
+	return []string{args.Password, args.SMTPPassword, args.DatabasePassword}
+}
+
+// Masked returns a copy of arguments with passwords replaced by the mask to print them
+func (args ArgumentOptions) Masked() ArgumentOptions {
+	for _, password := range []*string{&args.Password, &args.SMTPPassword, &args.DatabasePassword} {
+		if *password != "" {
+			*password = logger.MaskedValue
+		}
+	}
+	return args
+}
+
 // Init initializes argument flags
 func (args *ArgumentOptions) Init() {
-	flag.StringVar(&args.ProjectName, "prjName", "", "Name of the project")
+	args.register(flag.CommandLine)
+	flag.Parse()
+}
+
+// Override sets arguments given in the command line over the saved ones.
+// Only flags listed in commandLineFlags are taken, lists replace saved lists.
+func (args *ArgumentOptions) Override() error {
+	return args.override(flag.CommandLine)
+}
+
+func (args *ArgumentOptions) override(commandLine *flag.FlagSet) error {
+	saved := *args
+	target := flag.NewFlagSet("saved arguments", flag.ContinueOnError)
+	// the registration sets default values, so saved values are restored after it
+	args.register(target)
+	*args = saved
+
+	var err error
+	commandLine.Visit(func(f *flag.Flag) {
+		if !isCommandLineFlag(f.Name) {
+			return
+		}
+		targetFlag := target.Lookup(f.Name)
+		if list, ok := f.Value.(*stringSlice); ok {
+			*targetFlag.Value.(*stringSlice) = append(stringSlice(nil), *list...)
+			return
+		}
+		if setErr := targetFlag.Value.Set(f.Value.String()); setErr != nil && err == nil {
+			err = fmt.Errorf("flag -%s: %w", f.Name, setErr)
+		}
+	})
+	return err
+}
+
+func isCommandLineFlag(name string) bool {
+	for _, flagName := range commandLineFlags {
+		if flagName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDefaults sets defaults of settings which were added after the arguments were saved
+// and which mustn't be 0, e.g. the watch mode without the settle time installs half-copied files
+func (args *ArgumentOptions) applyDefaults() {
+	defaults := &ArgumentOptions{}
+	defaults.register(flag.NewFlagSet("defaults", flag.ContinueOnError))
+
+	for _, setting := range []struct{ value, defaultValue *int }{
+		{&args.WatchInterval, &defaults.WatchInterval},
+		{&args.WatchSettle, &defaults.WatchSettle},
+		{&args.WindowLength, &defaults.WindowLength},
+	} {
+		if *setting.value == 0 {
+			*setting.value = *setting.defaultValue
+		}
+	}
+}
+
+func (args *ArgumentOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&args.ProjectName, "prjName", "", "Name of the project")
 
 	// connection flags
-	flag.StringVar(&args.ConsoleServiceName, "c", "", "Name of console monolitic service")
-	flag.StringVar(&args.WorkingDirectory, "d", "", "Path to the working directory")
-	flag.StringVar(&args.NetPipeServiceName, "n", "", "Name of netpipe service")
-	flag.StringVar(&args.User, "u", "", "User name with admin permisions")
-	flag.StringVar(&args.Password, "p", "", "Password for user")
+	fs.StringVar(&args.ConsoleServiceName, "c", "", "Name of console monolitic service")
+	fs.StringVar(&args.WorkingDirectory, "d", "", "Path to the working directory")
+	fs.StringVar(&args.NetPipeServiceName, "n", "", "Name of netpipe service")
+	fs.StringVar(&args.User, "u", "", "User name with admin permisions")
+	fs.StringVar(&args.Password, "p", "", "Password for user")
 
 	// mailing flags
-	flag.Var(&args.ToEmailList, "t", "List of emails which the message will be send. Each email must start with '-t' flag")
-	flag.StringVar(&args.Body, "b", "See the attached log file for details", "Message body")
-	flag.StringVar(&args.From, "f", "sergey.zalunin@akforta.com", "From email")
-	flag.StringVar(&args.SMTPServer, "smtp", "mail.akforta.com", "address of SMTP server")
-	flag.IntVar(&args.SMTPPort, "port", 465, "Port of SMTP server")
-	flag.StringVar(&args.SMTPLogin, "smtplogin", "", "Login to SMTP server")
-	flag.StringVar(&args.SMTPPassword, "smtppass", "", "Password to SMTP server")
+	fs.Var(&args.ToEmailList, "t", "List of emails which the message will be send. Each email must start with '-t' flag")
+	fs.StringVar(&args.Body, "b", "See the attached log file for details", "Message body")
+	fs.StringVar(&args.From, "f", "sergey.zalunin@akforta.com", "From email")
+	fs.StringVar(&args.SMTPServer, "smtp", "mail.akforta.com", "address of SMTP server")
+	fs.IntVar(&args.SMTPPort, "port", 465, "Port of SMTP server")
+	fs.StringVar(&args.SMTPLogin, "smtplogin", "", "Login to SMTP server")
+	fs.StringVar(&args.SMTPPassword, "smtppass", "", "Password to SMTP server")
 
 	// database flags
-	flag.StringVar(&args.DbDataSource, "dbdatasource", "localhost", "Database data source name")
-	flag.StringVar(&args.DatabaseName, "dbname", "", "Database Name")
-	flag.StringVar(&args.DatabaseUserID, "dbuserid", "", "Database Login")
-	flag.StringVar(&args.DatabasePassword, "dbpassword", "", "Database Password")
-	flag.StringVar(&args.BackupPath, "backuppath", "", "Path to store backups of database")
-	flag.BoolVar(&args.UseCompression, "usecompr", false, "Use compression on backup database")
-	flag.BoolVar(&args.TrustedConnection, "dbtrust", false, "Database allows trusted connection")
-	flag.IntVar(&args.ConnectionTimeout, "dbtimeout", 7200, "Connection timeout to mssql")
-	flag.BoolVar(&args.SkipBackup, "skipbackup", false, "SkipBackup added to skip backup of the second installation. "+
+	fs.StringVar(&args.DbDataSource, "dbdatasource", "localhost", "Database data source name")
+	fs.StringVar(&args.DatabaseName, "dbname", "", "Database Name")
+	fs.StringVar(&args.DatabaseUserID, "dbuserid", "", "Database Login")
+	fs.StringVar(&args.DatabasePassword, "dbpassword", "", "Database Password")
+	fs.StringVar(&args.BackupPath, "backuppath", "", "Path to store backups of database")
+	fs.BoolVar(&args.UseCompression, "usecompr", false, "Use compression on backup database")
+	fs.BoolVar(&args.TrustedConnection, "dbtrust", false, "Database allows trusted connection")
+	fs.IntVar(&args.ConnectionTimeout, "dbtimeout", 7200, "Connection timeout to mssql")
+	fs.BoolVar(&args.SkipBackup, "skipbackup", false, "SkipBackup added to skip backup of the second installation. "+
 		"E.g the first installation was failed. "+
 		"So it is not necessary to make backup from brocken database")
+	fs.BoolVar(&args.DryRun, "dryrun", false,
+		"Print the installation plan without stopping services, making a backup or loading replications")
+	fs.BoolVar(&args.Resume, "resume", false,
+		"Continue the previous failed run from the last completed step. "+
+			"The backup is skipped if the previous run has already made it")
+	fs.BoolVar(&args.Rollback, "rollback", false,
+		"Restore the database from the backup made before the installation if any replication fails to import")
+	fs.BoolVar(&args.SQLLock, "sqllock", false,
+		"Lock the database by sp_getapplock, so loaders of different hosts don't install replications at once")
+	fs.BoolVar(&args.Force, "force", false,
+		"Import replications again even if the history says they have been already applied")
+	fs.BoolVar(&args.HistoryTable, "historytable", false,
+		"Keep the history of applied replications in ReplicLoaderHistory table of the target database "+
+			"in addition to history.jsonl of the replication directory")
+	fs.IntVar(&args.ImportTimeout, "importtimeout", 0,
+		"Minutes to wait for the import of each replication before AdminToolsConsole is killed, 0 waits forever")
+	fs.IntVar(&args.CompilationTimeout, "compiletimeout", 0,
+		"Minutes to wait for the compilation before BIZ.Compiler is killed, 0 waits forever")
+	fs.Var(&args.FailPatterns, "failpattern",
+		"Case insensitive regular expression failing the run if the output of a tool matches it "+
+			"even if the exit code is 0, e.g. Exception. Each pattern must start with '-failpattern' flag")
+	fs.StringVar(&args.Order, "order", "mtime",
+		"Order of installation: mtime by modification time of files, "+
+			"sequence by numbers the file names start with, e.g. 0009_, or by sequences of package manifests, "+
+			"with files without numbers going last by mtime, "+
+			"or dependency declared in package manifests")
+	fs.StringVar(&args.Compile, "compile", "always",
+		"When to compile after imports: always, onimports if at least one replication was imported, "+
+			"or never. Use 'compile' command to compile without imports")
+
+	// archive of processed replications
+	fs.StringVar(&args.ArchiveMode, "archive", "delete",
+		"What to do with processed replication files: delete, move or zip. "+
+			"Archived files are kept in archive/<run-id> directory, failed ones in failed/<run-id>")
+	fs.IntVar(&args.ArchiveKeep, "archivekeep", 0, "Number of the last runs kept in the archive, 0 keeps all")
+	fs.IntVar(&args.ArchiveDays, "archivedays", 0, "Days to keep runs in the archive, 0 keeps forever")
+	fs.BoolVar(&args.ArchiveApplied, "archiveapplied", false,
+		"Process replications skipped as already applied by -archive mode. "+
+			"By default they are left in the replication directory")
+
+	// maintenance windows
+	fs.Var(&args.MaintenanceWindows, "window",
+		"Cron expression of the maintenance window start, e.g. \"0 2 * * SAT\". "+
+			"Replications are installed only inside windows. Each window must start with '-window' flag")
+	fs.IntVar(&args.WindowLength, "windowlength", 120, "Length of maintenance windows in minutes")
+	fs.IntVar(&args.WindowMinRemaining, "windowmin", 30,
+		"Minimum minutes left in the maintenance window to start the installation. "+
+			"Replications left when the window ends are postponed to the next window, the running one is finished")
+
+	// watch mode
+	fs.BoolVar(&args.Watch, "watch", false,
+		"Run as a daemon which installs replications as soon as they appear in the replication directory")
+	fs.IntVar(&args.WatchInterval, "watchinterval", 30, "Seconds between checks of the replication directory")
+	fs.IntVar(&args.WatchSettle, "watchsettle", 60,
+		"Seconds during which replication files mustn't change before the installation. "+
+			"It skips files which are still being copied")
 
 	// interactive mode
-	flag.BoolVar(&args.UseInteractive, "interactive", false,
+	fs.BoolVar(&args.UseInteractive, "interactive", false,
 		"Call the process to set up arguments settings in the console. "+
 			"All entered values will store in the file which reads on starting this program")
-	flag.BoolVar(&args.SaveArgs, "saveargs", false,
+	fs.BoolVar(&args.SaveArgs, "saveargs", false,
 		"Saving entered arguments in the file which reads on starting this programm")
-	flag.BoolVar(&args.ReadSavedArgs, "rsd", false,
+	fs.BoolVar(&args.ReadSavedArgs, "rsd", false,
 		"Reading saving arguments from the data.dat file")
-
-	flag.Parse()
 }
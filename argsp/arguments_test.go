@@ -0,0 +1,108 @@
+package argsp
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// parseCommandLine parses flags as they are given in the command line
+func parseCommandLine(t *testing.T, flags ...string) *flag.FlagSet {
+	t.Helper()
+	commandLine := flag.NewFlagSet("loader", flag.ContinueOnError)
+	(&ArgumentOptions{}).register(commandLine)
+	if err := commandLine.Parse(flags); err != nil {
+		t.Fatal(err)
+	}
+	return commandLine
+}
+
+func TestOverrideKeepsCommandLineFlags(t *testing.T) {
+	commandLine := parseCommandLine(t, "-watchsettle", "5", "-dbname", "Other")
+
+	args := &ArgumentOptions{DatabaseName: "Saved", WatchInterval: 10, WatchSettle: 60}
+	if err := args.override(commandLine); err != nil {
+		t.Fatalf("override() error = %v", err)
+	}
+
+	// the database isn't taken from the command line, it is changed only by saving arguments again
+	want := &ArgumentOptions{DatabaseName: "Saved", WatchInterval: 10, WatchSettle: 5}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("override() = %+v, want %+v", args, want)
+	}
+}
+
+func TestApplyDefaultsToOldSavedArguments(t *testing.T) {
+	args := &ArgumentOptions{DatabaseName: "Saved", WatchInterval: 10}
+	args.applyDefaults()
+
+	if args.WatchInterval != 10 || args.WatchSettle != 60 || args.WindowLength != 120 {
+		t.Errorf("applyDefaults() = interval %d, settle %d, window %d, want 10, 60, 120",
+			args.WatchInterval, args.WatchSettle, args.WindowLength)
+	}
+}
+
+func TestOverrideRollback(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		saved bool
+		want  bool
+	}{
+		{"saved value without the flag", nil, true, true},
+		{"flag set", []string{"-rollback"}, false, true},
+		{"flag switched off", []string{"-rollback=false"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := &ArgumentOptions{Rollback: tt.saved}
+			if err := args.override(parseCommandLine(t, tt.flags...)); err != nil {
+				t.Fatalf("override() error = %v", err)
+			}
+			if args.Rollback != tt.want {
+				t.Errorf("Rollback = %t, want %t", args.Rollback, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverrideReplacesSavedWindows(t *testing.T) {
+	args := &ArgumentOptions{MaintenanceWindows: stringSlice{"0 1 * * *", "0 3 * * *"}, WindowLength: 120}
+	commandLine := parseCommandLine(t, "-window", "0 2 * * SAT", "-window", "0 4 * * SUN")
+	if err := args.override(commandLine); err != nil {
+		t.Fatalf("override() error = %v", err)
+	}
+
+	want := stringSlice{"0 2 * * SAT", "0 4 * * SUN"}
+	if !reflect.DeepEqual(args.MaintenanceWindows, want) || args.WindowLength != 120 {
+		t.Errorf("override() windows = %q, length %d, want %q, 120", args.MaintenanceWindows, args.WindowLength, want)
+	}
+}
+
+func TestPasswordsOfCommandLineAreSecrets(t *testing.T) {
+	args := &ArgumentOptions{}
+	commandLine := flag.NewFlagSet("loader", flag.ContinueOnError)
+	args.register(commandLine)
+	err := commandLine.Parse([]string{"-p", "Adm1n!pass", "-smtppass", "smtp-secret", "-dbpassword", "db-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Adm1n!pass", "smtp-secret", "db-secret"}
+	if got := args.Secrets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Secrets() = %v, want %v", got, want)
+	}
+
+	masked := args.Masked()
+	for _, password := range []string{masked.Password, masked.SMTPPassword, masked.DatabasePassword} {
+		if password != logger.MaskedValue {
+			t.Errorf("Masked() password = %q, want %q", password, logger.MaskedValue)
+		}
+	}
+	if args.Password != "Adm1n!pass" {
+		t.Error("Masked() changed the arguments")
+	}
+}
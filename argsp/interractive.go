@@ -44,9 +44,28 @@ func SaveArguments(inArgs *ArgumentOptions, log *logger.Log) {
 // ReadArguments from the file
 func ReadArguments(log *logger.Log) *ArgumentOptions {
 	args := Deserialize(log)
+	if !args.IsEmpty() {
+		args.applyDefaults()
+	}
 	return args
 }
 
+// CheckSavedArguments reads and decrypts the saved arguments without applying them.
+// It returns os.ErrNotExist if arguments haven't been saved.
+func CheckSavedArguments() error {
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+
+	encodedArgs, err := readGob()
+	if err != nil {
+		return err
+	}
+
+	_, err = decodeArguments(encodedArgs)
+	return err
+}
+
 func deepCopy(args *ArgumentOptions, log *logger.Log) *ArgumentOptions {
 	arr, err := json.Marshal(args)
 	if err != nil {
@@ -69,6 +88,10 @@ func switchOfUnecessaryAttributes(args *ArgumentOptions) {
 	args.SaveArgs = false
 	args.ReadSavedArgs = false
 	args.SkipBackup = false
+	args.DryRun = false
+	args.Resume = false
+	args.Force = false
+	args.Watch = false
 }
 
 func startMode(args *ArgumentOptions, log *logger.Log) {
@@ -83,6 +106,18 @@ func startMode(args *ArgumentOptions, log *logger.Log) {
 	// database flags
 	setDatabaseSettings(args, log)
 
+	// installation flags
+	setInstallationSettings(args, log)
+
+	// archive flags
+	setArchiveSettings(args, log)
+
+	// maintenance windows flags
+	setWindowSettings(args, log)
+
+	// watch mode flags
+	setWatchSettings(args, log)
+
 	switchOfUnecessaryAttributes(args)
 }
 
@@ -130,6 +165,47 @@ func setDatabaseSettings(args *ArgumentOptions, log *logger.Log) {
 	}
 }
 
+func setInstallationSettings(args *ArgumentOptions, log *logger.Log) {
+	fmt.Println("\nDo you want to enter installation settings (default - yes)?")
+	if yes(log) {
+		setRollback(args, log)
+		setSQLLock(args, log)
+		setOrder(args, log)
+		setHistoryTable(args, log)
+		setImportTimeout(args, log)
+		setCompilationTimeout(args, log)
+		setFailPatterns(args, log)
+		setCompile(args, log)
+	}
+}
+
+func setArchiveSettings(args *ArgumentOptions, log *logger.Log) {
+	fmt.Println("\nDo you want to enter archive settings (default - yes)?")
+	if yes(log) {
+		setArchiveMode(args, log)
+		setArchiveKeep(args, log)
+		setArchiveDays(args, log)
+		setArchiveApplied(args, log)
+	}
+}
+
+func setWindowSettings(args *ArgumentOptions, log *logger.Log) {
+	fmt.Println("\nDo you want to enter maintenance window settings (default - yes)?")
+	if yes(log) {
+		setMaintenanceWindows(args, log)
+		setWindowLength(args, log)
+		setWindowMinRemaining(args, log)
+	}
+}
+
+func setWatchSettings(args *ArgumentOptions, log *logger.Log) {
+	fmt.Println("\nDo you want to enter watch mode settings (default - yes)?")
+	if yes(log) {
+		setWatchInterval(args, log)
+		setWatchSettle(args, log)
+	}
+}
+
 func printStringDefaults(message string, defaultValue string) {
 	if defaultValue == "" {
 		fmt.Printf("%s: ", message)
@@ -308,3 +384,140 @@ func setConnectionTimeout(args *ArgumentOptions, log *logger.Log) {
 	}
 	args.ConnectionTimeout = timeout
 }
+
+// installation flags
+
+func setRollback(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Rollback on failed import (previous - %t): ", args.Rollback)
+	args.Rollback = readBool(log, args.Rollback)
+}
+
+func setSQLLock(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Lock the database by sp_getapplock (previous - %t): ", args.SQLLock)
+	args.SQLLock = readBool(log, args.SQLLock)
+}
+
+func setOrder(args *ArgumentOptions, log *logger.Log) {
+	printStringDefaults("Enter Order of installation: mtime, sequence or dependency", args.Order)
+	args.Order = readStringLine(log, args.Order)
+}
+
+func setHistoryTable(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Keep the history in the database (previous - %t): ", args.HistoryTable)
+	args.HistoryTable = readBool(log, args.HistoryTable)
+}
+
+func setImportTimeout(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Import Timeout in minutes (previous - %d): ", args.ImportTimeout)
+	args.ImportTimeout = readInt(log, args.ImportTimeout)
+}
+
+func setCompilationTimeout(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Compilation Timeout in minutes (previous - %d): ", args.CompilationTimeout)
+	args.CompilationTimeout = readInt(log, args.CompilationTimeout)
+}
+
+func setFailPatterns(args *ArgumentOptions, log *logger.Log) {
+	defaultValue := strings.Join(args.FailPatterns, " ")
+	printStringDefaults("Enter Fail Patterns divided by a space", defaultValue)
+	args.FailPatterns = strings.Fields(readStringLine(log, defaultValue))
+}
+
+func setCompile(args *ArgumentOptions, log *logger.Log) {
+	printStringDefaults("Enter Compile policy: always, onimports or never", args.Compile)
+	args.Compile = readStringLine(log, args.Compile)
+}
+
+// archive flags
+
+func setArchiveMode(args *ArgumentOptions, log *logger.Log) {
+	printStringDefaults("Enter Archive mode: delete, move or zip", args.ArchiveMode)
+	args.ArchiveMode = readStringLine(log, args.ArchiveMode)
+}
+
+func setArchiveKeep(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Number of runs kept in the archive (previous - %d): ", args.ArchiveKeep)
+	args.ArchiveKeep = readInt(log, args.ArchiveKeep)
+}
+
+func setArchiveDays(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Days to keep runs in the archive (previous - %d): ", args.ArchiveDays)
+	args.ArchiveDays = readInt(log, args.ArchiveDays)
+}
+
+func setArchiveApplied(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Archive replications skipped as already applied (previous - %t): ", args.ArchiveApplied)
+	args.ArchiveApplied = readBool(log, args.ArchiveApplied)
+}
+
+// maintenance windows flags
+
+// setMaintenanceWindows reads cron expressions divided by a semicolon, because they contain spaces
+func setMaintenanceWindows(args *ArgumentOptions, log *logger.Log) {
+	defaultValue := strings.Join(args.MaintenanceWindows, "; ")
+	printStringDefaults("Enter Maintenance Windows as cron expressions divided by a semicolon", defaultValue)
+	line := readStringLine(log, defaultValue)
+
+	args.MaintenanceWindows = nil
+	for _, window := range strings.Split(line, ";") {
+		if window = strings.TrimSpace(window); window != "" {
+			args.MaintenanceWindows = append(args.MaintenanceWindows, window)
+		}
+	}
+}
+
+func setWindowLength(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Maintenance Window Length in minutes (previous - %d): ", args.WindowLength)
+	args.WindowLength = readInt(log, args.WindowLength)
+}
+
+func setWindowMinRemaining(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Minimum minutes left in the window to start (previous - %d): ", args.WindowMinRemaining)
+	args.WindowMinRemaining = readInt(log, args.WindowMinRemaining)
+}
+
+// watch mode flags
+
+func setWatchInterval(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Watch Interval in seconds (previous - %d): ", args.WatchInterval)
+	args.WatchInterval = readInt(log, args.WatchInterval)
+}
+
+func setWatchSettle(args *ArgumentOptions, log *logger.Log) {
+	fmt.Printf("Enter Watch Settle time in seconds (previous - %d): ", args.WatchSettle)
+	args.WatchSettle = readInt(log, args.WatchSettle)
+}
+
+// readBool reads yes or no keeping the previous value if nothing is entered.
+// The question is repeated until the answer is recognized.
+func readBool(log *logger.Log, defaultValue bool) bool {
+	for {
+		if value, ok := parseBool(readStringLine(log, defaultValue)); ok {
+			return value
+		}
+		fmt.Printf("Enter yes or no (previous - %t): ", defaultValue)
+	}
+}
+
+// parseBool recognizes yes/no, y/n, true/false and 1/0 answers
+func parseBool(answer string) (value bool, ok bool) {
+	switch strings.TrimSpace(strings.ToLower(answer)) {
+	case "yes", "y", "true", "t", "1":
+		return true, true
+	case "no", "n", "false", "f", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// readInt reads a number keeping the previous value if nothing or not a number is entered
+func readInt(log *logger.Log, defaultValue int) int {
+	line := readStringLine(log, defaultValue)
+
+	value, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		log.Error(err)
+		return defaultValue
+	}
+	return value
+}
@@ -120,6 +120,9 @@ func decodeArguments(encodedArgs []byte) (interface{}, error) {
 
 	
     nonceSize := gcm.NonceSize()
+	if len(encodedArgs) < nonceSize {
+		return nil, fmt.Errorf("dencodeArguments, the file is too short to be decoded")
+	}
     nonce, ciphertext := encodedArgs[:nonceSize], encodedArgs[nonceSize:]
 
 	obj, err := gcm.Open(nil, nonce, ciphertext, nil)
@@ -0,0 +1,28 @@
+package argsp
+
+import "testing"
+
+func TestParseBool(t *testing.T) {
+	tests := []struct {
+		answer   string
+		want, ok bool
+	}{
+		{"yes", true, true},
+		{"Y", true, true},
+		{" true\r", true, true},
+		{"1", true, true},
+		{"no", false, true},
+		{"N", false, true},
+		{"FALSE", false, true},
+		{"0", false, true},
+		{"", false, false},
+		{"sure", false, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseBool(tt.answer)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseBool(%q) = %t, %t, want %t, %t", tt.answer, got, ok, tt.want, tt.ok)
+		}
+	}
+}
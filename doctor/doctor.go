@@ -0,0 +1,184 @@
+// Package doctor checks the environment of the replication loader
+// without stopping services or changing the database
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/loader"
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/message"
+	"github.com/sergeyzalunin/go-replication-loader/mssql"
+	"github.com/sergeyzalunin/go-replication-loader/services"
+)
+
+// Command is the name of the subcommand running diagnostics
+const Command = "doctor"
+
+// Status is the result of a check
+type Status string
+
+const (
+	// StatusPass means the check succeeded
+	StatusPass Status = "PASS"
+	// StatusFail means the check found a problem
+	StatusFail Status = "FAIL"
+	// StatusSkip means the check isn't applicable to the configuration
+	StatusSkip Status = "SKIP"
+)
+
+// Options are flags of the doctor subcommand
+type Options struct {
+	JSON     bool
+	TestMail bool
+}
+
+// RegisterFlags adds flags of the subcommand, they must be registered before flags are parsed
+func RegisterFlags() *Options {
+	options := &Options{}
+	flag.BoolVar(&options.JSON, "json", false, "doctor: print results in JSON")
+	flag.BoolVar(&options.TestMail, "testmail", false, "doctor: send a test email to recipients")
+	return options
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report contains results of all checks
+type Report struct {
+	Passed  bool     `json:"passed"`
+	Results []Result `json:"results"`
+	// mask hides passwords which could get into details of errors
+	mask func(string) string
+}
+
+// Run performs all checks of the configuration
+func Run(ctx context.Context, args *argsp.ArgumentOptions, options *Options, log *logger.Log) *Report {
+	r := &Report{Passed: true, mask: log.Mask}
+
+	r.checkSavedArguments()
+	r.checkDatabase(ctx, args)
+	r.checkService(ctx, "Console monolithic service", args.ConsoleServiceName, true, log)
+	r.checkService(ctx, "Netpipe service", args.NetPipeServiceName, false, log)
+	r.checkTools(args, log)
+	r.checkEmail(args, options, log)
+
+	return r
+}
+
+func (r *Report) add(name string, status Status, detail string) {
+	if status == StatusFail {
+		r.Passed = false
+	}
+	if r.mask != nil {
+		detail = r.mask(detail)
+	}
+	r.Results = append(r.Results, Result{name, status, detail})
+}
+
+func (r *Report) addError(name string, err error, detail string) {
+	if err != nil {
+		r.add(name, StatusFail, strings.Join(strings.Fields(err.Error()), " "))
+		return
+	}
+	r.add(name, StatusPass, detail)
+}
+
+func (r *Report) checkSavedArguments() {
+	const name = "Saved arguments (data.dat)"
+	err := argsp.CheckSavedArguments()
+	if errors.Is(err, os.ErrNotExist) {
+		r.add(name, StatusSkip, "arguments haven't been saved")
+		return
+	}
+	r.addError(name, err, "decrypted")
+}
+
+func (r *Report) checkDatabase(ctx context.Context, args *argsp.ArgumentOptions) {
+	size, err := mssql.DatabaseSize(ctx, args)
+	r.addError("SQL Server connection", err, fmt.Sprintf("%s on %s, %d MB of data",
+		args.DatabaseName, args.DbDataSource, size>>20))
+	if err != nil {
+		r.add("BACKUP DATABASE permission", StatusSkip, "no connection")
+		return
+	}
+
+	if args.SkipBackup {
+		r.add("BACKUP DATABASE permission", StatusSkip, "backup is skipped")
+		return
+	}
+	r.addError("BACKUP DATABASE permission", mssql.CheckBackupPermission(ctx, args), "granted")
+}
+
+func (r *Report) checkService(ctx context.Context, name, serviceName string, required bool, log *logger.Log) {
+	if serviceName == "" {
+		if required {
+			r.add(name, StatusFail, "the service name isn't set")
+		} else {
+			r.add(name, StatusSkip, "the service name isn't set")
+		}
+		return
+	}
+
+	state, err := services.NewService(serviceName, log).State(ctx)
+	r.addError(name, err, fmt.Sprintf("%s is %s", serviceName, state))
+}
+
+func (r *Report) checkTools(args *argsp.ArgumentOptions, log *logger.Log) {
+	executor := loader.NewProcessExecutor(args.WorkingDirectory, log)
+	for _, path := range []string{executor.PathToAdminToolsConsole, executor.PathToCompilationPluting} {
+		_, err := os.Stat(path)
+		r.addError("Executable "+path, err, "exists")
+	}
+}
+
+func (r *Report) checkEmail(args *argsp.ArgumentOptions, options *Options, log *logger.Log) {
+	e := message.New(args, log)
+	if !e.IsConfigured() {
+		r.add("SMTP login", StatusSkip, "email isn't configured")
+		r.add("Test email", StatusSkip, "email isn't configured")
+		return
+	}
+
+	err := e.CheckLogin()
+	r.addError("SMTP login", err, fmt.Sprintf("%s as %s", args.SMTPServer, args.SMTPLogin))
+
+	switch {
+	case !options.TestMail:
+		r.add("Test email", StatusSkip, "use -testmail flag to send it")
+	case err != nil:
+		r.add("Test email", StatusSkip, "SMTP login failed")
+	default:
+		r.addError("Test email", e.SendTest(), "sent to "+strings.Join(args.ToEmailList, ", "))
+	}
+}
+
+// WriteTable prints results as a table
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tDETAILS")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Status, result.Name, result.Detail)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON prints results in JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// Argument is a single argument of the command line
+type Argument struct {
+	Value string
+	// Secret arguments are masked when the command line is logged
+	Secret bool
+	quoted bool
+}
+
+// CommandLine keeps arguments of a tool as structured data.
+// Arguments are escaped by the rules of CommandLineToArgvW only when the command line is built,
+// so values with quotes or trailing backslashes can't break it or inject other flags.
+type CommandLine struct {
+	args []Argument
+	// Raw quotes every option value even if it has no spaces,
+	// because AdminToolsConsole parses unquoted values differently.
+	// Values are put into quotes as they are, like AdminToolsConsole has always been called,
+	// only quotes and backslashes before them or at the end are escaped,
+	// because such values couldn't be passed at all and broke the rest of the command line.
+	Raw bool
+}
+
+// NewCommandLine is a constructor for CommandLine
+func NewCommandLine(raw bool) *CommandLine {
+	return &CommandLine{Raw: raw}
+}
+
+// Flag adds --name
+func (c *CommandLine) Flag(name string) *CommandLine {
+	c.args = append(c.args, Argument{Value: "--" + name})
+	return c
+}
+
+// Option adds --name value, nothing is added if the value is empty
+func (c *CommandLine) Option(name, value string) *CommandLine {
+	return c.option(name, value, false)
+}
+
+// SecretOption adds --name value which value is masked in the log
+func (c *CommandLine) SecretOption(name, value string) *CommandLine {
+	return c.option(name, value, true)
+}
+
+// IntOption adds --name value
+func (c *CommandLine) IntOption(name string, value int) *CommandLine {
+	c.args = append(c.args, Argument{Value: "--" + name}, Argument{Value: strconv.Itoa(value)})
+	return c
+}
+
+func (c *CommandLine) option(name, value string, secret bool) *CommandLine {
+	if value == "" {
+		return c
+	}
+	c.args = append(c.args, Argument{Value: "--" + name}, Argument{Value: value, Secret: secret, quoted: c.Raw})
+	return c
+}
+
+// Args returns unescaped arguments for platforms passing them as a list
+func (c *CommandLine) Args() []string {
+	result := make([]string, len(c.args))
+	for i, arg := range c.args {
+		result[i] = arg.Value
+	}
+	return result
+}
+
+// String returns the escaped command line to start the process
+func (c *CommandLine) String() string {
+	return c.join(false)
+}
+
+// Masked returns the escaped command line with secrets replaced by the mask to log it
+func (c *CommandLine) Masked() string {
+	return c.join(true)
+}
+
+func (c *CommandLine) join(mask bool) string {
+	result := make([]string, len(c.args))
+	for i, arg := range c.args {
+		value := arg.Value
+		if mask && arg.Secret {
+			value = logger.MaskedValue
+		}
+		result[i] = escapeArg(value, arg.quoted)
+	}
+	return strings.Join(result, " ")
+}
+
+// escapeArg escapes the argument by the rules of CommandLineToArgvW:
+// backslashes are doubled only before a quote or the closing quote, quotes are escaped by a backslash
+func escapeArg(arg string, alwaysQuote bool) string {
+	if !alwaysQuote && arg != "" && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+
+	result := strings.Builder{}
+	result.WriteByte('"')
+	backslashes := 0
+	for i := 0; i < len(arg); i++ {
+		switch arg[i] {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			result.WriteString(strings.Repeat(`\`, backslashes*2+1))
+		default:
+			result.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		result.WriteByte(arg[i])
+	}
+	result.WriteString(strings.Repeat(`\`, backslashes*2))
+	result.WriteByte('"')
+	return result.String()
+}
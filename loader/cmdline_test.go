@@ -0,0 +1,201 @@
+package loader
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+)
+
+// splitCommandLine splits the command line by the rules of CommandLineToArgvW
+// for arguments after the program name
+func splitCommandLine(line string) []string {
+	var result []string
+	var arg strings.Builder
+	inArg, inQuotes := false, false
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				result = append(result, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			backslashes := 0
+			for ; i < len(line) && line[i] == '\\'; i++ {
+				backslashes++
+			}
+			inArg = true
+			if i < len(line) && line[i] == '"' {
+				arg.WriteString(strings.Repeat(`\`, backslashes/2))
+				if backslashes%2 == 1 {
+					arg.WriteByte('"')
+					continue
+				}
+			} else {
+				arg.WriteString(strings.Repeat(`\`, backslashes))
+			}
+			i--
+		case c == '"':
+			inArg = true
+			if inQuotes && i+1 < len(line) && line[i+1] == '"' {
+				arg.WriteByte('"')
+				i++
+				continue
+			}
+			inQuotes = !inQuotes
+		default:
+			inArg = true
+			arg.WriteByte(c)
+		}
+	}
+	if inArg {
+		result = append(result, arg.String())
+	}
+	return result
+}
+
+func TestEscapeArg(t *testing.T) {
+	tests := []struct {
+		name        string
+		arg         string
+		alwaysQuote bool
+		want        string
+	}{
+		{"plain", "admin", false, `admin`},
+		{"empty", "", false, `""`},
+		{"space", "Program Files", false, `"Program Files"`},
+		{"tab", "a\tb", false, "\"a\tb\""},
+		{"backslashes without quotes", `C:\Tools\bin`, false, `C:\Tools\bin`},
+		{"embedded quote", `pa"ss`, false, `"pa\"ss"`},
+		{"only quote", `"`, false, `"\""`},
+		{"backslash before quote", `a\"b`, false, `"a\\\"b"`},
+		{"trailing backslash quoted", `C:\Program Files\`, false, `"C:\Program Files\\"`},
+		{"trailing backslashes quoted", `C:\dir\\`, true, `"C:\dir\\\\"`},
+		{"trailing backslash unquoted", `C:\dir\`, false, `C:\dir\`},
+		{"raw plain", "admin", true, `"admin"`},
+		{"raw empty", "", true, `""`},
+		{"raw embedded quote", `x" --user "root`, true, `"x\" --user \"root"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := escapeArg(tt.arg, tt.alwaysQuote)
+			if got != tt.want {
+				t.Fatalf("escapeArg(%q, %t) = %s, want %s", tt.arg, tt.alwaysQuote, got, tt.want)
+			}
+			if parsed := splitCommandLine(got); !reflect.DeepEqual(parsed, []string{tt.arg}) {
+				t.Errorf("CommandLineToArgvW(%s) = %q, want [%q]", got, parsed, tt.arg)
+			}
+		})
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       *CommandLine
+		wantString string
+		wantMasked string
+		wantArgs   []string
+	}{
+		{
+			name:       "empty option is skipped",
+			line:       NewCommandLine(false).Flag("quiet").Option("user", "").IntOption("timeout", 30),
+			wantString: `--quiet --timeout 30`,
+			wantMasked: `--quiet --timeout 30`,
+			wantArgs:   []string{"--quiet", "--timeout", "30"},
+		},
+		{
+			name:       "raw mode quotes values",
+			line:       NewCommandLine(true).Option("user", "admin").SecretOption("password", `p"w\`),
+			wantString: `--user "admin" --password "p\"w\\"`,
+			wantMasked: `--user "admin" --password "***"`,
+			wantArgs:   []string{"--user", "admin", "--password", `p"w\`},
+		},
+		{
+			name:       "plain mode quotes only values which need it",
+			line:       NewCommandLine(false).Option("path", `C:\Program Files\`).SecretOption("password", "secret"),
+			wantString: `--path "C:\Program Files\\" --password secret`,
+			wantMasked: `--path "C:\Program Files\\" --password ***`,
+			wantArgs:   []string{"--path", `C:\Program Files\`, "--password", "secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.line.String(); got != tt.wantString {
+				t.Errorf("String() = %s, want %s", got, tt.wantString)
+			}
+			if got := tt.line.Masked(); got != tt.wantMasked {
+				t.Errorf("Masked() = %s, want %s", got, tt.wantMasked)
+			}
+			if got := tt.line.Args(); !reflect.DeepEqual(got, tt.wantArgs) {
+				t.Errorf("Args() = %q, want %q", got, tt.wantArgs)
+			}
+			if got := splitCommandLine(tt.line.String()); !reflect.DeepEqual(got, tt.wantArgs) {
+				t.Errorf("CommandLineToArgvW(String()) = %q, want %q", got, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// legacyArgument is the format of arguments AdminToolsConsole has always been called with:
+// the value in quotes without any escaping
+func legacyArgument(key, value string) string {
+	return fmt.Sprintf(`--%s "%s"`, key, value)
+}
+
+func TestRawCommandLineKeepsLegacyFormat(t *testing.T) {
+	tests := []struct {
+		user, password, file string
+	}{
+		{"admin", "secret", `C:\Replications\0001_orders.rep`},
+		{`DOMAIN\admin`, `p@ss w0rd!%^&*()`, `\\server\share\Replications\0002 prices.rep`},
+		{"администратор", "пароль", `D:\Репликации\0003.rep`},
+		{"admin", `back\slash`, `C:\Program Files\eLeed\0004.rep`},
+	}
+
+	for _, tt := range tests {
+		l := &Loader{args: &argsp.ArgumentOptions{User: tt.user, Password: tt.password}}
+		got := l.getAdminToolsConsoleArguments(tt.file).String()
+
+		want := strings.Join([]string{
+			legacyArgument("plugin", "InnerReplicationPlugin"),
+			legacyArgument("user", tt.user),
+			legacyArgument("password", tt.password),
+			"--import --nocompilation --verbose 4",
+			legacyArgument("file", tt.file),
+		}, " ")
+		if got != want {
+			t.Errorf("AdminToolsConsole arguments = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestRawCommandLineEscapesValuesLegacyFormatBreaks(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		// the legacy "p"w" ends the value at the quote
+		{`p"w`, `--password "p\"w"`},
+		// the legacy "C:\dir\" escapes the closing quote and swallows the next arguments
+		{`C:\dir\`, `--password "C:\dir\\"`},
+		{`a\"b`, `--password "a\\\"b"`},
+	}
+
+	for _, tt := range tests {
+		line := NewCommandLine(true).SecretOption("password", tt.value)
+		if got := line.String(); got != tt.want {
+			t.Errorf("String() of %q = %s, want %s", tt.value, got, tt.want)
+		}
+		if got := splitCommandLine(line.String()); !reflect.DeepEqual(got, []string{"--password", tt.value}) {
+			t.Errorf("CommandLineToArgvW(%s) = %q, want the value back", line, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"fmt"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// compensation undoes a step of the installation, e.g. starts a stopped service
+type compensation struct {
+	name   string
+	action func() error
+}
+
+// compensationStack keeps compensations of completed steps
+// to undo them in reverse order if the installation fails
+type compensationStack struct {
+	log   *logger.Log
+	items []compensation
+}
+
+func newCompensationStack(log *logger.Log) *compensationStack {
+	return &compensationStack{log: log}
+}
+
+// push adds the compensation unless the stack already has one with the same name
+func (s *compensationStack) push(name string, action func() error) {
+	for _, item := range s.items {
+		if item.name == name {
+			return
+		}
+	}
+	s.items = append(s.items, compensation{name, action})
+}
+
+// remove drops the compensation when its step was undone by the normal flow
+func (s *compensationStack) remove(name string) {
+	for i, item := range s.items {
+		if item.name == name {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// unwind runs all compensations in reverse order
+// and returns the report about each of them
+func (s *compensationStack) unwind() []string {
+	var report []string
+
+	for len(s.items) > 0 {
+		item := s.items[len(s.items)-1]
+		s.items = s.items[:len(s.items)-1]
+
+		s.log.Info("Restoring after the failure: ", item.name)
+		err := s.action(item)
+		if err == nil {
+			report = append(report, fmt.Sprintf("%s: done", item.name))
+		} else {
+			s.log.Error(err, "Failed to restore after the failure: ", item.name)
+			report = append(report, fmt.Sprintf("%s: failed with error %v", item.name, err))
+		}
+	}
+
+	return report
+}
+
+// action runs the compensation, a panic in it mustn't stop unwinding
+func (s *compensationStack) action(item compensation) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = toError(r)
+		}
+	}()
+	return item.action()
+}
+
+func toError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", r)
+}
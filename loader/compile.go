@@ -0,0 +1,124 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CompilePolicy defines when BIZ.Compiler runs after imports
+type CompilePolicy string
+
+const (
+	// CompileAlways compiles after every installation
+	CompileAlways CompilePolicy = "always"
+	// CompileOnImports compiles only if at least one replication was imported
+	CompileOnImports CompilePolicy = "onimports"
+	// CompileNever leaves the compilation to the administrator, e.g. to the compile command
+	CompileNever CompilePolicy = "never"
+)
+
+// ParseCompilePolicy converts the name of the policy to CompilePolicy
+func ParseCompilePolicy(name string) (CompilePolicy, error) {
+	policy := CompilePolicy(strings.ToLower(strings.TrimSpace(name)))
+	switch policy {
+	case "":
+		return CompileAlways, nil
+	case CompileAlways, CompileOnImports, CompileNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown compile policy %q, expected %s, %s or %s",
+			name, CompileAlways, CompileOnImports, CompileNever)
+	}
+}
+
+// Compile stops services, compiles the solution and starts services again
+// without importing any replication.
+// If the compilation fails or panics all stopped services are started again.
+// The failure is reported like the failure of the installation.
+// The success isn't reported, because the report of success describes installed replications.
+func (l *Loader) Compile(ctx context.Context) (err error) {
+	var started bool
+	defer func() {
+		if err != nil {
+			l.notify(started, err)
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			started = true
+			err = l.compensate(toError(r))
+		}
+	}()
+
+	started, err = l.compile(ctx)
+	if err != nil && started {
+		err = l.compensate(err)
+	}
+	return err
+}
+
+// compile returns true if the compilation was started, so its result has to be reported
+func (l *Loader) compile(ctx context.Context) (bool, error) {
+	unlock, err := l.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	l.log.Info("Compilation is started by the compile command, replications aren't imported")
+
+	if err = l.preflight(ctx); err != nil {
+		return true, err
+	}
+
+	err = l.stopService(ctx, l.netpipeService, netpipeCompensation)
+	l.log.LogIfError(err, "Failed stop the netpipe service")
+
+	err = l.stopService(ctx, l.consoleService, consoleCompensation)
+	if err != nil {
+		return true, fmt.Errorf("%w %s: %v", ErrServiceStop, l.args.ConsoleServiceName, err)
+	}
+
+	if err = l.runCompilation(ctx); err != nil {
+		return true, err
+	}
+
+	err = l.startService(ctx, l.consoleService, consoleCompensation)
+	if err != nil {
+		return true, fmt.Errorf("%w %s: %v", ErrServiceStart, l.args.ConsoleServiceName, err)
+	}
+
+	err = l.startService(ctx, l.netpipeService, netpipeCompensation)
+	l.log.LogIfError(err, "Failed to start the netpipe service")
+	l.log.Info("The compilation is completed successfully")
+	return true, nil
+}
+
+// shouldCompile decides by the compile policy whether the compilation runs after imports
+func (l *Loader) shouldCompile(policy CompilePolicy, hasNewImports bool) bool {
+	switch {
+	case policy == CompileNever:
+		l.log.Info("Compilation skipped due to the compile policy ", policy)
+		return false
+	case policy == CompileOnImports && !hasNewImports && !l.journal.Done(StepFileImported):
+		l.log.Info("Compilation skipped, because no replication was imported")
+		return false
+	case l.journal.Done(StepCompilationDone) && !hasNewImports:
+		l.log.Info("Compilation skipped, because the resumed run has already passed this step")
+		return false
+	default:
+		return true
+	}
+}
+
+// runCompilation runs BIZ.Compiler, its compilation errors are returned within CompilationError
+func (l *Loader) runCompilation(ctx context.Context) error {
+	args := l.getCompilationPluginArguments()
+	err := l.executor.RunCompilationPluting(ctx, args)
+	if err != nil {
+		return &CompilationError{exitCode(err), err, l.executor.lastOutput().CompilationErrors}
+	}
+	return nil
+}
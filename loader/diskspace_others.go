@@ -0,0 +1,14 @@
+// +build !windows
+
+package loader
+
+import "syscall"
+
+// freeSpace returns the number of bytes available to the user on the disk of the path
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
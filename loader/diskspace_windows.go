@@ -0,0 +1,15 @@
+package loader
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the number of bytes available to the user on the disk of the path
+func freeSpace(path string) (uint64, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available, total, free uint64
+	err = windows.GetDiskFreeSpaceEx(name, &available, &total, &free)
+	return available, err
+}
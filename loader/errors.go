@@ -0,0 +1,195 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrServiceStop is returned when a service couldn't be stopped before the installation
+	ErrServiceStop = errors.New("failed to stop the service")
+	// ErrServiceStart is returned when a service couldn't be started
+	ErrServiceStart = errors.New("failed to start the service")
+	// ErrInterrupted is returned when the installation was interrupted by user or cancelled
+	ErrInterrupted = errors.New("the installation was interrupted")
+	// ErrTimeout is returned when a tool was killed after its timeout
+	ErrTimeout = errors.New("the process timed out")
+	// ErrOutputFailure is returned when the output of a tool matches a fail pattern
+	ErrOutputFailure = errors.New("the tool output reports a failure")
+	// ErrCompilationFailed is returned when BIZ.Compiler reports compilation errors
+	ErrCompilationFailed = errors.New("the compilation reported errors")
+)
+
+// interruptedError is ErrInterrupted caused by the cancelled context,
+// so the reason of cancellation can be checked as well
+type interruptedError struct {
+	cause error
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInterrupted, e.cause)
+}
+
+func (e *interruptedError) Is(target error) bool {
+	return target == ErrInterrupted
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.cause
+}
+
+// TimeoutError is returned when the tool runs longer than its timeout,
+// the tool and its child processes are killed in this case
+type TimeoutError struct {
+	Tool    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s was killed after the timeout of %s", e.Tool, e.Timeout)
+}
+
+// Is allows to check the error by errors.Is(err, ErrTimeout)
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// OutputError is returned when the tool completed successfully,
+// but its output matched fail patterns
+type OutputError struct {
+	Tool     string
+	Failures []string
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("%v, %s printed: %s", ErrOutputFailure, e.Tool, strings.Join(e.Failures, "; "))
+}
+
+// Is allows to check the error by errors.Is(err, ErrOutputFailure)
+func (e *OutputError) Is(target error) bool {
+	return target == ErrOutputFailure
+}
+
+// ProcessError is returned when an external tool fails to run
+// or completes with a non-zero exit code
+type ProcessError struct {
+	Tool     string
+	ExitCode int
+	Err      error
+}
+
+func (e *ProcessError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s completed with code %d", e.Tool, e.ExitCode)
+	}
+	return fmt.Sprintf("%s completed with code %d: %v", e.Tool, e.ExitCode, e.Err)
+}
+
+// Unwrap returns the error of running the process
+func (e *ProcessError) Unwrap() error {
+	return e.Err
+}
+
+// PreflightError is returned when resources needed by the installation are missing,
+// nothing is changed in this case
+type PreflightError struct {
+	Failures []string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("pre-flight checks failed, no service was stopped:\r\n%s",
+		strings.Join(e.Failures, "\r\n"))
+}
+
+// ImportError is returned when a replication file fails to import
+type ImportError struct {
+	File     string
+	ExitCode int
+	Err      error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("the replication %s failed to import with code %d: %v", e.File, e.ExitCode, e.Err)
+}
+
+// Unwrap returns the error of AdminToolsConsole
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// CompilationError is returned when BIZ.Compiler fails.
+// Messages are compilation errors found in its output.
+type CompilationError struct {
+	ExitCode int
+	Err      error
+	Messages []CompilationMessage
+}
+
+func (e *CompilationError) Error() string {
+	result := fmt.Sprintf("the compilation failed with code %d: %v", e.ExitCode, e.Err)
+	for _, m := range e.Messages {
+		result += fmt.Sprintf("\r\n%s(%d): %s", m.File, m.Line, m.Message)
+	}
+	return result
+}
+
+// Unwrap returns the error of BIZ.Compiler
+func (e *CompilationError) Unwrap() error {
+	return e.Err
+}
+
+// RollbackError is returned when the database was rolled back after the failure.
+// RestoreErr is set if the rollback itself failed.
+type RollbackError struct {
+	Err        error
+	Backup     string
+	RestoreErr error
+}
+
+func (e *RollbackError) Error() string {
+	if e.RestoreErr != nil {
+		return fmt.Sprintf("%v\r\nRollback to the backup %s failed: %v", e.Err, e.Backup, e.RestoreErr)
+	}
+	return fmt.Sprintf("%v\r\nThe database was rolled back to the backup %s made before the installation",
+		e.Err, e.Backup)
+}
+
+// Unwrap returns the error caused the rollback
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// IsRolledBack returns true if the database was successfully restored from the backup
+func (e *RollbackError) IsRolledBack() bool {
+	return e.RestoreErr == nil
+}
+
+// FailureError is returned when the installation fails.
+// It contains the results of restoring services after the failure.
+type FailureError struct {
+	Err           error
+	Compensations []string
+}
+
+func (e *FailureError) Error() string {
+	if len(e.Compensations) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v\r\nRestoring after the failure:\r\n%s",
+		e.Err, strings.Join(e.Compensations, "\r\n"))
+}
+
+// Unwrap returns the error caused the failure
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+func exitCode(err error) int {
+	var processErr *ProcessError
+	if errors.As(err, &processErr) {
+		return processErr.ExitCode
+	}
+	return -1
+}
@@ -0,0 +1,113 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// outputWaitDelay is how long the output is read after the process exits.
+// Children left running by the tool may keep the pipe open, then the rest of the output is dropped.
+var outputWaitDelay = 5 * time.Second
+
+// Result is the output and the exit code of a finished process.
+// The exit code is -1 if the process wasn't started.
+type Result struct {
+	ExitCode int
+	Output   []byte
+}
+
+// Executor runs an external tool with the command line arguments.
+// Stdout and stderr of the tool are written to the output as they arrive, if it's set.
+// It returns an error if the tool couldn't be started or completed with a non-zero exit code.
+type Executor interface {
+	Run(ctx context.Context, tool string, args *CommandLine, output io.Writer) (Result, error)
+}
+
+// OSExecutor runs tools as processes of the operating system.
+// The whole process tree is killed if the context is cancelled,
+// because tools start child processes which would keep running.
+type OSExecutor struct{}
+
+// NewOSExecutor is a constructor for OSExecutor
+func NewOSExecutor() *OSExecutor {
+	return &OSExecutor{}
+}
+
+// runCommand starts the command and waits for its completion
+// killing its process tree when the context is cancelled
+func runCommand(ctx context.Context, cmd *exec.Cmd, stream io.Writer) (Result, error) {
+	var output bytes.Buffer
+	var writer io.Writer = &output
+	if stream != nil {
+		writer = io.MultiWriter(&output, stream)
+	}
+
+	// the pipe is read here instead of by exec, because Wait of exec waits until the pipe is closed
+	// by all children of the tool, even by those left running after the tool exits
+	reader, pipe, err := os.Pipe()
+	if err != nil {
+		return Result{ExitCode: -1}, err
+	}
+	defer reader.Close()
+	// the same pipe for stdout and stderr keeps lines in order
+	cmd.Stdout, cmd.Stderr = pipe, pipe
+	prepareTree(cmd)
+
+	err = cmd.Start()
+	// the process has its own copy of the pipe
+	pipe.Close()
+	if err != nil {
+		return Result{ExitCode: -1}, err
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(writer, reader)
+		close(copied)
+	}()
+
+	tree, err := attachTree(cmd)
+	defer tree.close()
+	if err != nil {
+		tree.kill()
+		cmd.Wait()
+		waitOutput(reader, copied)
+		return Result{ExitCode: -1, Output: output.Bytes()}, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			tree.kill()
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	waitOutput(reader, copied)
+	return Result{exitCodeOf(cmd), output.Bytes()}, err
+}
+
+// waitOutput waits until the exited process output is read, but no longer than outputWaitDelay
+func waitOutput(reader *os.File, copied <-chan struct{}) {
+	select {
+	case <-copied:
+	case <-time.After(outputWaitDelay):
+		// closing the pipe stops reading
+		reader.Close()
+		<-copied
+	}
+}
+
+func exitCodeOf(cmd *exec.Cmd) int {
+	if cmd.ProcessState == nil {
+		return -1
+	}
+	return cmd.ProcessState.ExitCode()
+}
@@ -0,0 +1,41 @@
+// +build !windows
+
+package loader
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// Run starts the tool and waits for its completion
+func (e *OSExecutor) Run(ctx context.Context, tool string, args *CommandLine, output io.Writer) (Result, error) {
+	if _, err := exec.LookPath(tool); err != nil {
+		return Result{ExitCode: -1}, err
+	}
+
+	cmd := exec.Command(tool, args.Args()...)
+	return runCommand(ctx, cmd, output)
+}
+
+// processTree is the process group of the process and its children
+type processTree struct {
+	cmd *exec.Cmd
+}
+
+// prepareTree starts the process in a new process group
+func prepareTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func attachTree(cmd *exec.Cmd) (*processTree, error) {
+	return &processTree{cmd}, nil
+}
+
+func (t *processTree) kill() {
+	// the negative pid kills the whole process group
+	syscall.Kill(-t.cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func (t *processTree) close() {}
@@ -0,0 +1,50 @@
+// +build !windows
+
+package loader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunDoesNotWaitForChildrenLeftRunning(t *testing.T) {
+	delay := outputWaitDelay
+	outputWaitDelay = 100 * time.Millisecond
+	defer func() { outputWaitDelay = delay }()
+
+	// the child keeps stdout of the tool open after the tool exits
+	args := &CommandLine{args: []Argument{{Value: "-c"}, {Value: "sleep 30 & echo imported; echo failed >&2"}}}
+
+	started := time.Now()
+	result, err := NewOSExecutor().Run(context.Background(), "sh", args, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("Run returned after %v, it waited for the child", elapsed)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("exit code %d, want 0", result.ExitCode)
+	}
+	if output := string(result.Output); !strings.Contains(output, "imported\n") || !strings.Contains(output, "failed\n") {
+		t.Errorf("output %q, want stdout and stderr of the tool", output)
+	}
+}
+
+func TestRunKillsProcessTreeWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	args := &CommandLine{args: []Argument{{Value: "-c"}, {Value: "sleep 30 & sleep 30"}}}
+
+	started := time.Now()
+	_, err := NewOSExecutor().Run(ctx, "sh", args, nil)
+	if err == nil {
+		t.Error("the killed process has no error")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("Run returned after %v, the process tree wasn't killed", elapsed)
+	}
+}
@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Run starts the tool and waits for its completion
+func (e *OSExecutor) Run(ctx context.Context, tool string, args *CommandLine, output io.Writer) (Result, error) {
+	if _, err := exec.LookPath(tool); err != nil {
+		return Result{ExitCode: -1}, err
+	}
+
+	cmd := exec.Command(tool)
+
+	// Filename + args sets directly due to avoid auto arguments escaping.
+	// Akforta.eLeed.AdminToolsConsole.exe can't handle arguments escaped by exec package,
+	// so the command line escapes them itself
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow: true,
+		CmdLine:    fmt.Sprintf(`"%s" %s`, tool, args),
+	}
+	return runCommand(ctx, cmd, output)
+}
+
+// processTree is the job object containing the process and its children
+type processTree struct {
+	cmd *exec.Cmd
+	job windows.Handle
+}
+
+// prepareTree starts the process suspended, so it can't start children before it's put to the job
+func prepareTree(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+}
+
+// attachTree puts the suspended process to a new job object and resumes it.
+// Only the process itself is killed if the job couldn't be created.
+func attachTree(cmd *exec.Cmd) (*processTree, error) {
+	tree := &processTree{cmd: cmd, job: newJob(cmd.Process.Pid)}
+	return tree, resumeProcess(cmd.Process.Pid)
+}
+
+// newJob puts the process to a new job object, zero handle is returned if it failed
+func newJob(pid int) windows.Handle {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return 0
+	}
+	defer windows.CloseHandle(process)
+
+	if err = windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return 0
+	}
+	return job
+}
+
+// resumeProcess resumes the main thread of the process started suspended.
+// exec doesn't keep the thread handle, so the thread is found by the snapshot of threads.
+func resumeProcess(pid int) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	resumed := false
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != uint32(pid) {
+			continue
+		}
+		if resumeErr := resumeThread(entry.ThreadID); resumeErr != nil {
+			return resumeErr
+		}
+		resumed = true
+	}
+	if err != windows.ERROR_NO_MORE_FILES {
+		return err
+	}
+	if !resumed {
+		return fmt.Errorf("the main thread of the process %d isn't found", pid)
+	}
+	return nil
+}
+
+func resumeThread(id uint32) error {
+	thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, id)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(thread)
+
+	_, err = windows.ResumeThread(thread)
+	return err
+}
+
+func (t *processTree) kill() {
+	if t.job != 0 {
+		windows.TerminateJobObject(t.job, 1)
+		return
+	}
+	t.cmd.Process.Kill()
+}
+
+func (t *processTree) close() {
+	if t.job != 0 {
+		windows.CloseHandle(t.job)
+	}
+}
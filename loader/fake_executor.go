@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FakeCall is a tool run recorded by FakeExecutor
+type FakeCall struct {
+	Tool string
+	Args string
+}
+
+// FakeExecutor is a scripted Executor for tests, it doesn't start any process.
+// Tools are matched by their file names, e.g. BIZ.Compiler.exe.
+type FakeExecutor struct {
+	mu      sync.Mutex
+	scripts map[string][]Result
+	calls   []FakeCall
+}
+
+// NewFakeExecutor is a constructor for FakeExecutor
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{scripts: map[string][]Result{}}
+}
+
+// Script queues results returned by the next runs of the tool.
+// The last result is repeated, a tool without a script succeeds with exit code 0.
+func (f *FakeExecutor) Script(tool string, results ...Result) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.ToLower(filepath.Base(tool))
+	f.scripts[key] = append(f.scripts[key], results...)
+	return f
+}
+
+// Run returns the next scripted result of the tool and writes its output to the output.
+// A non-zero exit code is returned with an error like a real process.
+func (f *FakeExecutor) Run(ctx context.Context, tool string, args *CommandLine, output io.Writer) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{ExitCode: -1}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, FakeCall{tool, args.String()})
+
+	key := strings.ToLower(filepath.Base(tool))
+	var result Result
+	if script := f.scripts[key]; len(script) > 0 {
+		result = script[0]
+		if len(script) > 1 {
+			f.scripts[key] = script[1:]
+		}
+	}
+
+	if output != nil {
+		output.Write(result.Output)
+	}
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	return result, nil
+}
+
+// Calls returns all runs recorded by the executor
+func (f *FakeExecutor) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FakeCall(nil), f.calls...)
+}
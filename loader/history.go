@@ -0,0 +1,145 @@
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/mssql"
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+)
+
+// openHistory opens the local history of applied replications
+// and the history table of the database if it's required.
+// The returned function closes the history table.
+func (l *Loader) openHistory(ctx context.Context) (func(), error) {
+	l.history = []replication.History{replication.NewFileHistory(l.repl.Directory(), l.args.DatabaseName)}
+	if !l.args.HistoryTable {
+		return func() {}, nil
+	}
+	if l.args.DryRun {
+		// the table would be created in the database
+		l.log.Info("[dry run] The history table of database isn't checked, only the local history is")
+		return func() {}, nil
+	}
+
+	table, err := mssql.OpenHistoryTable(ctx, l.args)
+	if err != nil {
+		l.log.Error(err, "Failed to open the history table of database ", l.args.DatabaseName)
+		return nil, err
+	}
+	l.history = append(l.history, table)
+	return func() { table.Close() }, nil
+}
+
+// skipApplied returns replications which haven't been applied yet.
+// Applied replications are imported again if -force flag is set,
+// otherwise they are left in the replication directory, unless -archiveapplied flag is set.
+// Replications imported by the resumed run are left to the journal.
+func (l *Loader) skipApplied(replications []replication.Replication) ([]replication.Replication, error) {
+	var result []replication.Replication
+	skipped := map[string]int{}
+
+	for _, rep := range replications {
+		// files of packages aren't extracted in dry run
+		if rep.Package != "" && l.args.DryRun {
+			result = append(result, rep)
+			continue
+		}
+
+		hash, err := replication.FileHash(rep.Path)
+		if err != nil {
+			return nil, err
+		}
+		rep.Hash = hash
+
+		record, err := l.findApplied(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case record == nil || record.RunID == l.journal.RunID():
+			result = append(result, rep)
+		case l.args.Force:
+			l.log.Info("The replication ", rep.Name(), " has been already applied as ", record.File,
+				" by the run ", record.RunID, ", it's imported again because of -force flag")
+			result = append(result, rep)
+		default:
+			l.log.Info("WARNING: the replication ", rep.Name(), " is skipped, because it has been already applied as ",
+				record.File, " to ", record.Database, " by the run ", record.RunID, " at ", record.Time.Format(time.RFC3339),
+				". Use -force flag to import it again or -archiveapplied flag to archive it")
+			l.disposeApplied(rep)
+			skipped[rep.Package]++
+		}
+	}
+
+	l.disposeAppliedPackages(replications, skipped)
+	return result, nil
+}
+
+func (l *Loader) findApplied(hash string) (*replication.HistoryRecord, error) {
+	for _, history := range l.history {
+		record, err := history.Find(hash)
+		if err != nil || record != nil {
+			return record, err
+		}
+	}
+	return nil, nil
+}
+
+// disposeApplied removes or archives the skipped bare replication file if it's required,
+// files of packages are removed with their package
+func (l *Loader) disposeApplied(rep replication.Replication) {
+	if rep.Package == "" && l.args.ArchiveApplied {
+		l.removeReplication(rep.Path, l.descriptionOf(rep))
+	}
+}
+
+// disposeAppliedPackages removes or archives packages which all replications are skipped if it's required.
+// Extracted files of packages left in the replication directory are removed anyway.
+func (l *Loader) disposeAppliedPackages(replications []replication.Replication, skipped map[string]int) {
+	total := map[string]int{}
+	descriptions := map[string][]string{}
+	for _, rep := range replications {
+		total[rep.Package]++
+		descriptions[rep.Package] = append(descriptions[rep.Package], l.descriptionOf(rep))
+	}
+
+	for pkg, count := range skipped {
+		switch {
+		case pkg == "" || count != total[pkg]:
+		case l.args.ArchiveApplied:
+			l.removePackage(pkg, descriptions[pkg]...)
+		default:
+			err := l.repl.RemoveStaging(pkg)
+			l.log.LogIfError(err, "Failed to remove extracted files of the package ", pkg)
+		}
+	}
+}
+
+// recordApplied adds the imported replication to all histories
+func (l *Loader) recordApplied(rep replication.Replication) {
+	if l.args.DryRun {
+		return
+	}
+
+	record := replication.HistoryRecord{
+		Hash:     rep.Hash,
+		File:     rep.Name(),
+		Database: l.args.DatabaseName,
+		RunID:    l.journal.RunID(),
+		Time:     time.Now(),
+	}
+	for _, history := range l.history {
+		err := history.Add(record)
+		l.log.LogIfError(err, "Failed to add the replication ", rep.Name(), " to the history")
+	}
+}
+
+// forgetRun removes replications of the run from all histories after the database is restored
+func (l *Loader) forgetRun() {
+	for _, history := range l.history {
+		err := history.Forget(l.journal.RunID())
+		l.log.LogIfError(err, "Failed to remove replications of the run ", l.journal.RunID(), " from the history")
+	}
+}
@@ -0,0 +1,40 @@
+package loader
+
+import (
+	"strings"
+
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+)
+
+// ReplicationSource provides replications to install
+type ReplicationSource interface {
+	Directory() string
+	// Lock takes the exclusive lock of the directory, so only one loader installs its replications
+	Lock() (replication.Unlocker, error)
+	GetReplications(target replication.Target, order replication.OrderStrategy, preview bool) ([]replication.Replication, error)
+	RemoveStaging(packagePath string) error
+}
+
+// Notifier reports the result of the run which had replications to install
+type Notifier interface {
+	Notify(report RunReport) error
+}
+
+// RunReport is the result of the run
+type RunReport struct {
+	RunID string
+	Err   error
+	// Outputs are parsed outputs of tools run by the installation
+	Outputs []ToolOutput
+	// Descriptions are contents of descriptions of imported replications
+	Descriptions []string
+}
+
+// Summary describes outputs of tools in a few lines per run
+func (r RunReport) Summary() string {
+	var result []string
+	for _, output := range r.Outputs {
+		result = append(result, output.Summary())
+	}
+	return strings.Join(result, "\r\n")
+}
@@ -0,0 +1,205 @@
+package loader
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+const journalFileName = "journal.jsonl"
+
+// Step is a stage of the installation process written to the journal
+type Step string
+
+const (
+	// StepServicesStopped indicates that services were stopped
+	StepServicesStopped Step = "ServicesStopped"
+	// StepBackupDone indicates that the backup of database was made
+	StepBackupDone Step = "BackupDone"
+	// StepFileImported indicates that a replication file was imported
+	StepFileImported Step = "FileImported"
+	// StepCompilationDone indicates that the compilation was completed
+	StepCompilationDone Step = "CompilationDone"
+	// StepServicesRestarted indicates that services were started again
+	StepServicesRestarted Step = "ServicesRestarted"
+)
+
+// JournalRecord is a line of the run journal
+type JournalRecord struct {
+	Time  time.Time
+	RunID string
+	Step  Step
+	File  string `json:",omitempty"`
+}
+
+// Journal keeps the progress of the installation on disk,
+// so an interrupted run can be resumed from the last completed step
+type Journal struct {
+	log      *logger.Log
+	runID    string
+	path     string
+	readOnly bool
+	records  []JournalRecord
+	// overwrite means the file still has records of the previous run
+	// which are replaced by the first record of this run
+	overwrite bool
+}
+
+// OpenJournal opens the journal in the replication directory.
+// The previous records are kept only if the run is resumed,
+// otherwise the journal starts from scratch.
+// The file isn't changed until the first step is recorded,
+// so opening the journal is safe while another loader is running.
+func OpenJournal(dir string, resume, readOnly bool, log *logger.Log) (*Journal, error) {
+	j := &Journal{
+		log:      log,
+		runID:    newRunID(),
+		path:     filepath.Join(dir, journalFileName),
+		readOnly: readOnly,
+	}
+
+	records, err := readJournal(j.path)
+	if err != nil {
+		return j, err
+	}
+
+	if resume {
+		j.records = records
+		if len(records) == 0 {
+			log.Info("There is no unfinished run to resume, the installation starts from scratch")
+		} else {
+			log.Info("The run is resumed after the step ", records[len(records)-1].Step)
+			if records[0].RunID != "" {
+				j.runID = records[0].RunID
+			}
+		}
+		return j, nil
+	}
+
+	if len(records) > 0 {
+		log.Info("The previous run was not completed, its journal will be overwritten. ",
+			"Use -resume flag to continue the previous run")
+		j.overwrite = true
+	}
+
+	return j, nil
+}
+
+func readJournal(path string) ([]JournalRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []JournalRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record JournalRecord
+		// the last line may be broken if the process was killed while writing it
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// Record writes the completed step to the journal
+func (j *Journal) Record(step Step, file string) {
+	record := JournalRecord{Time: time.Now(), RunID: j.runID, Step: step}
+	if file != "" {
+		record.File = filepath.Base(file)
+	}
+	j.records = append(j.records, record)
+
+	if j.readOnly {
+		return
+	}
+
+	err := j.append(record)
+	if err != nil {
+		j.log.Error(err, "Failed to write the step ", step, " to the journal ", j.path)
+	}
+}
+
+func (j *Journal) append(record JournalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if j.overwrite {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(j.path, flags, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	j.overwrite = false
+
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// RunID returns the identifier of the run, the resumed run keeps the identifier of the previous one
+func (j *Journal) RunID() string {
+	return j.runID
+}
+
+// IsPending returns true if the journal has steps of an unfinished run
+func (j *Journal) IsPending() bool {
+	return len(j.records) > 0
+}
+
+// Done returns true if the step has been already completed
+func (j *Journal) Done(step Step) bool {
+	for _, record := range j.records {
+		if record.Step == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Imported returns true if the replication file has been already imported
+func (j *Journal) Imported(file string) bool {
+	name := filepath.Base(file)
+	for _, record := range j.records {
+		if record.Step == StepFileImported && record.File == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete removes the journal after the successful run
+func (j *Journal) Complete() {
+	j.records = nil
+	if j.readOnly {
+		return
+	}
+
+	err := os.Remove(j.path)
+	if err != nil && !os.IsNotExist(err) {
+		j.log.Error(err, "Failed to remove the journal ", j.path)
+	}
+}
+
+// newRunID returns the identifier of a run sortable by its start time
+func newRunID() string {
+	return time.Now().Format("20060102-150405")
+}
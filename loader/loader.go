@@ -1,129 +1,581 @@
 package loader
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"github.com/sergeyzalunin/go-replication-loader/argsp"
 	"github.com/sergeyzalunin/go-replication-loader/logger"
 	"github.com/sergeyzalunin/go-replication-loader/mssql"
 	"github.com/sergeyzalunin/go-replication-loader/replication"
+	"github.com/sergeyzalunin/go-replication-loader/schedule"
 	"github.com/sergeyzalunin/go-replication-loader/services"
 )
 
+const (
+	consoleCompensation = "Start the console monolithic service"
+	netpipeCompensation = "Start the netpipe service"
+)
+
 // Loader is a container that has instances to load replications
 type Loader struct {
 	log            *logger.Log
 	args           *argsp.ArgumentOptions
-	repl           *replication.ReplicationLoader
+	repl           ReplicationSource
 	executor       *ProcessExecutor
 	consoleService services.IService
 	netpipeService services.IService
+	journal        *Journal
+	archive        *replication.Archive
+	history        []replication.History
+	backup         mssql.BackupProvider
+	backupMade     bool
+	compensations  *compensationStack
+	checks         []namedCheck
+	notifier       Notifier
+	// descriptions are contents of descriptions of imported replications to report
+	descriptions []string
+	// now is the clock maintenance windows are checked by
+	now func() time.Time
+	// windows are maintenance windows and windowEnd is the end of the current one,
+	// it's zero if windows aren't set
+	windows   *schedule.Schedule
+	windowEnd time.Time
+	// hasReplications is set as soon as there are replications to install,
+	// so the run is reported even if it panics
+	hasReplications bool
 }
 
 // NewLoader is a constructor to create a new Loader struct
-func NewLoader(args *argsp.ArgumentOptions, log *logger.Log) *Loader {
-	repl := &replication.ReplicationLoader{}
-	err := repl.Init(args.DatabaseName, log)
+// with services, tools and database of the arguments
+func NewLoader(args *argsp.ArgumentOptions, log *logger.Log) (*Loader, error) {
+	return NewLoaderBuilder(args, log).WithDefaults().Build()
+}
+
+// Load starts the process of loading.
+// If the installation fails, panics or the context is cancelled
+// all stopped services are started again in reverse order.
+// If the maintenance window ends, imported replications are compiled, services are started
+// and OutsideWindowError with the next window is returned, because the rest is postponed.
+func (l *Loader) Load(ctx context.Context) (hasReplications bool, err error) {
+	defer func() {
+		l.notify(hasReplications, err)
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			hasReplications = l.hasReplications
+			err = l.compensate(toError(r))
+		}
+	}()
+
+	hasReplications, err = l.load(ctx)
+	if err != nil && hasReplications && !errors.Is(err, schedule.ErrOutsideWindow) {
+		err = l.compensate(err)
+	}
+	return hasReplications, err
+}
+
+// notify reports the result of the run if there were replications to install
+func (l *Loader) notify(hasReplications bool, err error) {
+	if !hasReplications || l.args.DryRun || l.notifier == nil {
+		return
+	}
+
+	report := RunReport{RunID: l.RunID(), Err: err, Outputs: l.executor.Outputs, Descriptions: l.descriptions}
+	notifyErr := l.notifier.Notify(report)
+	l.log.LogIfError(notifyErr, "The notification wasn't sent")
+}
+
+func (l *Loader) load(ctx context.Context) (bool, error) {
+	unlock, err := l.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// the journal is opened under the lock, because another loader could be writing it
+	l.journal, err = OpenJournal(l.repl.Directory(), l.args.Resume, l.args.DryRun, l.log)
+	if err != nil {
+		l.log.Error(err, "Failed to open the journal of the run")
+	}
+
+	l.archive, err = replication.NewArchive(l.repl.Directory(), l.journal.RunID(),
+		l.args.ArchiveMode, l.args.ArchiveKeep, l.args.ArchiveDays, l.log)
 	if err != nil {
-		log.Error(err)
+		l.log.Error(err, "Archive of replications is set incorrectly")
+		return false, err
 	}
 
-	executor := NewProcessExecutor(args.WorkingDirectory, log)
-	console := services.NewService(args.ConsoleServiceName, log)
-	netpipe := services.NewService(args.NetPipeServiceName, log)
+	order, err := replication.ParseOrder(l.args.Order)
+	if err != nil {
+		l.log.Error(err, "Order of replications is set incorrectly")
+		return false, err
+	}
+
+	compilePolicy, err := ParseCompilePolicy(l.args.Compile)
+	if err != nil {
+		l.log.Error(err, "Compile policy is set incorrectly")
+		return false, err
+	}
+
+	replications, err := l.repl.GetReplications(l.target(), order, l.args.DryRun)
+	if errors.Is(err, replication.ErrInvalidPackage) || errors.Is(err, replication.ErrInvalidOrder) {
+		// the run is refused and reported, because replications won't be installed until they are fixed
+		l.hasReplications = true
+		return true, err
+	}
+	if err != nil {
+		l.log.Error(err)
+		return false, err
+	}
+
+	closeHistory, err := l.openHistory(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer closeHistory()
+
+	replications, err = l.skipApplied(replications)
+	if err != nil {
+		l.log.Error(err, "Failed to check the history of applied replications")
+		return false, err
+	}
+
+	if len(replications) == 0 && !l.journal.IsPending() {
+		return false, nil
+	}
+	l.hasReplications = true
+
+	if err = l.enterMaintenanceWindow(); err != nil {
+		return false, err
+	}
+	defer l.pruneArchive()
 
-	return &Loader{log, args, repl, executor, console, netpipe}
+	if err = l.preflight(ctx); err != nil {
+		return true, err
+	}
+
+	if err = l.preloadingProcess(ctx); err != nil {
+		return true, err
+	}
+
+	imported, err := l.importReplications(ctx, replications)
+	// the rest of replications is postponed to the next window,
+	// imported ones are compiled and services are started as usual
+	postponed := err
+	if err != nil && !errors.Is(err, schedule.ErrOutsideWindow) {
+		return true, err
+	}
+
+	if err = l.checkInterrupted(ctx); err != nil {
+		return true, err
+	}
+	if err = l.postloadingProcesses(ctx, compilePolicy, imported > 0); err != nil {
+		return true, err
+	}
+	l.journal.Complete()
+
+	switch {
+	case l.args.DryRun:
+		l.log.Info("[dry run] The installation plan is completed, nothing was changed")
+	case postponed != nil:
+		l.log.Info("Imported replications are installed, the rest is postponed, because ", postponed)
+	default:
+		l.log.Info("All replications have already loaded successfully")
+	}
+	return true, postponed
 }
 
-// Load starts the process of loading
-func (l *Loader) Load() (bool, error) {
-	hasReplications := false
-	replicationFiles := l.repl.GetReplicationFiles()
+// importReplications imports replications one by one and returns the number of imported ones
+func (l *Loader) importReplications(ctx context.Context, replications []replication.Replication) (int, error) {
+	imported := 0
+	var processed []replication.Replication
 
-	if len(replicationFiles) > 0 {
-		hasReplications = true
-		l.preloadingProcess()
+	for i, rep := range replications {
+		if err := l.checkInterrupted(ctx); err != nil {
+			return imported, err
+		}
+		if err := l.checkWindowEnd(); err != nil {
+			if len(processed) > 0 {
+				l.removeReplications(processed, rep.Package != processed[len(processed)-1].Package)
+			}
+			return imported, err
+		}
 
-		for _, rep := range replicationFiles {
-			l.log.Info("The replication ", rep, " is loading")
+		if l.journal.Imported(rep.Path) {
+			l.log.Info("The replication ", rep.Name(), " has been already imported by the resumed run")
+		} else {
+			l.log.Info("The replication ", rep.Path, " is loading")
 
-			args := l.getAdminToolsConsoleArguments(rep)
-			l.executor.RunAdminToolsConsole(args)
-			err := os.Remove(rep)
-			if err == nil {
-				l.log.Info("The replication file ", rep, " was deleted from folder")
-			} else {
-				msg := fmt.Sprintf("Failed to remove a replication file %s\n", rep)
-				l.log.Error(err, msg)
+			args := l.getAdminToolsConsoleArguments(rep.Path)
+			err := l.executor.RunAdminToolsConsole(ctx, rep.Path, args)
+			if err != nil {
+				l.storeFailedReplication(rep)
+				err = &ImportError{rep.Path, exitCode(err), err}
+				return imported, l.rollback(err)
 			}
+			l.journal.Record(StepFileImported, rep.Path)
+			l.recordApplied(rep)
+			imported++
 		}
+		l.readDescription(rep)
 
-		l.postloadingProcesses()
+		// imported files are kept until the end of the run
+		// to be able to install them again after rollback
+		processed = append(processed, rep)
+		lastOfPackage := i == len(replications)-1 || replications[i+1].Package != rep.Package
+		if !l.args.Rollback || i == len(replications)-1 {
+			l.removeReplications(processed, lastOfPackage)
+			processed = nil
+		}
 	}
-	return hasReplications, nil
+
+	return imported, nil
 }
 
-func (l *Loader) preloadingProcess() {
-	l.log.Info("Replication(s) is in the directory ", l.repl.ReplicationDirectory)
+// target returns the installation which packages are verified against
+func (l *Loader) target() replication.Target {
+	return replication.Target{
+		Database: l.args.DatabaseName,
+		Version: func() (string, error) {
+			return fileVersion(l.executor.AdminToolsConsolePath())
+		},
+	}
+}
 
-	err := l.netpipeService.StopService()
-	l.log.LogIfError(err, "Failed stop the netpipe service")
+// lock takes the exclusive lock of the replication directory
+// and the application lock of the database if it is enabled.
+// It returns the function releasing the locks.
+func (l *Loader) lock(ctx context.Context) (func(), error) {
+	if l.args.DryRun {
+		l.log.Info("[dry run] The replication directory would be locked")
+		return func() {}, nil
+	}
 
-	err = l.consoleService.StopService()
+	dirLock, err := l.repl.Lock()
 	if err != nil {
-		msg := "Failed to stop the console monolithic service"
-		l.log.Fatal(err, msg)
-		panic(msg)
+		l.log.Info("The installation is skipped, because ", err)
+		return nil, err
+	}
+	unlock := func() {
+		err := dirLock.Unlock()
+		l.log.LogIfError(err, "Failed to unlock the replication directory")
+	}
+
+	if !l.args.SQLLock {
+		return unlock, nil
 	}
 
-	mssql.DoBackup(l.args, l.log)
-	err = l.consoleService.StartService()
+	appLock, err := mssql.AcquireAppLock(ctx, l.args, l.log)
 	if err != nil {
-		msg := "Failed to start the console monolithic service"
-		l.log.Fatal(err, msg)
-		panic(msg)
+		l.log.Info("The installation is skipped, because ", err)
+		unlock()
+		return nil, err
 	}
+
+	return func() {
+		err := appLock.Release()
+		l.log.LogIfError(err, "Failed to release the application lock of the database")
+		unlock()
+	}, nil
 }
 
-func (l *Loader) postloadingProcesses() {
-	args := l.getCompilationPluginArguments()
-	l.executor.RunCompilationPluting(args)
+// enterMaintenanceWindow checks that the installation is allowed at the moment
+// and remembers the end of the maintenance window
+func (l *Loader) enterMaintenanceWindow() error {
+	windows, err := schedule.New(l.args.MaintenanceWindows, time.Duration(l.args.WindowLength)*time.Minute)
+	if err != nil {
+		l.log.Error(err, "Maintenance windows are set incorrectly")
+		return err
+	}
+
+	if windows.IsEmpty() {
+		return nil
+	}
 
-	l.netpipeService.StartService()
-	l.log.Info("All replications have already loaded successfully")
+	minRemaining := time.Duration(l.args.WindowMinRemaining) * time.Minute
+	end, err := windows.Check(l.now(), minRemaining)
+	if err != nil {
+		l.log.Info("Replications are waiting for the installation, but ", err)
+		return err
+	}
+
+	l.log.Info("The installation is in the maintenance window, which ends at ", end.Format(time.RFC3339))
+	l.windows, l.windowEnd = windows, end
+	return nil
 }
 
-func (l *Loader) getCompilationPluginArguments() string {
-	result := strings.Builder{}
-	result.Grow(100)
-	result.WriteString(getArgument("user", l.args.User))
-	result.WriteString(getArgument("password", l.args.Password))
-	return result.String()
+// checkWindowEnd stops importing between replications at the end of the maintenance window.
+// The replication being imported isn't interrupted, because the database would be left half-replicated.
+// OutsideWindowError with the next window is returned, so the rest is postponed.
+func (l *Loader) checkWindowEnd() error {
+	if l.windowEnd.IsZero() || l.now().Before(l.windowEnd) {
+		return nil
+	}
+
+	next, _ := l.windows.Next(l.windowEnd)
+	l.log.Info("The maintenance window ended at ", l.windowEnd.Format(time.RFC3339),
+		", the rest of replications is postponed")
+	return &schedule.OutsideWindowError{Next: next}
 }
 
-func (l *Loader) getAdminToolsConsoleArguments(rep string) string {
-	result := strings.Builder{}
-	result.Grow(200)
-	result.WriteString(getArgument("plugin", "InnerReplicationPlugin"))
-	result.WriteString(getArgument("user", l.args.User))
-	result.WriteString(getArgument("password", l.args.Password))
-	result.WriteString(" --import")
-	result.WriteString(" --nocompilation")
-	result.WriteString(getIntArgument("verbose", 4))
-	result.WriteString(getArgument("file", rep))
+// checkInterrupted stops the installation between steps if the context is cancelled
+func (l *Loader) checkInterrupted(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &interruptedError{err}
+	}
+	return nil
+}
 
-	return result.String()
+// compensate starts all services stopped by the installation
+func (l *Loader) compensate(err error) error {
+	l.log.Fatal(err, "The installation failed")
+	report := l.compensations.unwind()
+	return &FailureError{err, report}
 }
 
-func getArgument(key, value string) string {
-	if value == "" {
+// stopService stops the service and remembers to start it again on failure.
+// The compensation is added even if stopping failed,
+// because the service could be stopped partially.
+// The service is started with a new context,
+// because the context of installation may be already cancelled.
+func (l *Loader) stopService(ctx context.Context, service services.IService, compensationName string) error {
+	l.compensations.push(compensationName, func() error {
+		return service.StartService(context.Background())
+	})
+	return service.StopService(ctx)
+}
+
+func (l *Loader) startService(ctx context.Context, service services.IService, compensationName string) error {
+	err := service.StartService(ctx)
+	if err == nil {
+		l.compensations.remove(compensationName)
+	}
+	return err
+}
+
+// removeReplications deletes or archives processed replications.
+// Packages are archived after their last replication is processed,
+// extracted files of packages are just deleted.
+func (l *Loader) removeReplications(replications []replication.Replication, packageCompleted bool) {
+	var descriptions []string
+	for i, rep := range replications {
+		descriptions = append(descriptions, l.descriptionOf(rep))
+		if rep.Package == "" {
+			l.removeReplication(rep.Path, descriptions...)
+			descriptions = nil
+			continue
+		}
+
+		last := i == len(replications)-1 || replications[i+1].Package != rep.Package
+		if !last {
+			continue
+		}
+		if i < len(replications)-1 || packageCompleted {
+			l.removePackage(rep.Package, descriptions...)
+		}
+		descriptions = nil
+	}
+}
+
+// removeReplication removes or archives the replication file with its descriptions which exist
+func (l *Loader) removeReplication(rep string, descriptions ...string) {
+	if l.args.DryRun {
+		l.log.Info("[dry run] The replication file ", rep, " would be processed in ", l.archive.Mode, " archive mode")
+		return
+	}
+
+	err := l.archive.Store(rep)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to remove a replication file %s\n", rep)
+		l.log.Error(err, msg)
+	}
+
+	for _, desc := range descriptions {
+		if _, err = os.Stat(desc); os.IsNotExist(err) {
+			continue
+		}
+		err = l.archive.Store(desc)
+		l.log.LogIfError(err, "Failed to remove a description file ", desc)
+	}
+}
+
+func (l *Loader) removePackage(pkg string, descriptions ...string) {
+	l.removeReplication(pkg, descriptions...)
+	if l.args.DryRun {
+		return
+	}
+
+	err := l.repl.RemoveStaging(pkg)
+	l.log.LogIfError(err, "Failed to remove extracted files of the package ", pkg)
+}
+
+// descriptionOf returns the path to the description of the replication.
+// Descriptions of packages are put to the replication directory when packages are extracted.
+func (l *Loader) descriptionOf(rep replication.Replication) string {
+	return filepath.Join(l.repl.Directory(), filepath.Base(replication.DescriptionOf(rep.Path)))
+}
+
+// readDescription keeps the description of the imported replication to report it
+func (l *Loader) readDescription(rep replication.Replication) {
+	content, err := ioutil.ReadFile(l.descriptionOf(rep))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		l.log.Error(err, "Failed to read the description of the replication ", rep.Name())
+		return
+	}
+	l.descriptions = append(l.descriptions, string(content))
+}
+
+// storeFailedReplication moves the replication or its package to the failed directory
+func (l *Loader) storeFailedReplication(rep replication.Replication) {
+	if l.args.DryRun {
+		return
+	}
+
+	path := rep.Path
+	if rep.Package != "" {
+		path = rep.Package
+	}
+
+	err := l.archive.StoreFailed(path)
+	l.log.LogIfError(err, "Failed to move the replication file ", path, " to the failed directory")
+	if rep.Package != "" {
+		err = l.repl.RemoveStaging(rep.Package)
+		l.log.LogIfError(err, "Failed to remove extracted files of the package ", rep.Package)
+	}
+}
+
+func (l *Loader) pruneArchive() {
+	if l.args.DryRun {
+		return
+	}
+
+	err := l.archive.Prune()
+	l.log.LogIfError(err, "Failed to remove old runs from the archive")
+}
+
+// RunID returns the identifier of the last run,
+// which is the name of its directory in the archive
+func (l *Loader) RunID() string {
+	if l.journal == nil {
 		return ""
 	}
-	return fmt.Sprintf(" --%s \"%s\"", key, value)
+	return l.journal.RunID()
+}
+
+func (l *Loader) preloadingProcess(ctx context.Context) error {
+	l.log.Info("Replication(s) is in the directory ", l.repl.Directory())
+
+	err := l.stopService(ctx, l.netpipeService, netpipeCompensation)
+	l.log.LogIfError(err, "Failed stop the netpipe service")
+
+	err = l.stopService(ctx, l.consoleService, consoleCompensation)
+	if err != nil {
+		return fmt.Errorf("%w %s: %v", ErrServiceStop, l.args.ConsoleServiceName, err)
+	}
+
+	l.journal.Record(StepServicesStopped, "")
+
+	if l.journal.Done(StepBackupDone) || l.journal.Done(StepFileImported) {
+		l.log.Info("Backup of database skipped, because the resumed run has already passed this step")
+	} else {
+		err = l.backup.Backup(ctx)
+		if err != nil {
+			return err
+		}
+		l.backupMade = !l.args.SkipBackup && !l.args.DryRun
+		l.journal.Record(StepBackupDone, "")
+	}
+
+	err = l.startService(ctx, l.consoleService, consoleCompensation)
+	if err != nil {
+		return fmt.Errorf("%w %s: %v", ErrServiceStart, l.args.ConsoleServiceName, err)
+	}
+	return nil
+}
+
+func (l *Loader) postloadingProcesses(ctx context.Context, compilePolicy CompilePolicy, hasNewImports bool) error {
+	if l.shouldCompile(compilePolicy, hasNewImports) {
+		if err := l.runCompilation(ctx); err != nil {
+			return err
+		}
+		l.journal.Record(StepCompilationDone, "")
+	}
+
+	err := l.startService(ctx, l.netpipeService, netpipeCompensation)
+	l.log.LogIfError(err, "Failed to start the netpipe service")
+	l.journal.Record(StepServicesRestarted, "")
+	return nil
+}
+
+// rollback restores the database from the backup made before the installation
+// if the rollback policy is enabled. It returns the error to report.
+// The rollback isn't bound to the context of installation,
+// because it has to be completed even if the installation was cancelled.
+func (l *Loader) rollback(cause error) error {
+	ctx := context.Background()
+
+	if !l.args.Rollback {
+		return cause
+	}
+
+	if !l.backupMade {
+		l.log.Info("Rollback is impossible, because the backup wasn't made by this run")
+		return cause
+	}
+
+	l.log.Info("Rollback of database ", l.args.DatabaseName, " started due to the failed installation")
+	result := &RollbackError{Err: cause, Backup: mssql.BackupFileName(l.args)}
+
+	err := l.stopService(ctx, l.consoleService, consoleCompensation)
+	if err != nil {
+		l.log.Error(err, "Rollback failed to stop the console monolithic service")
+		result.RestoreErr = fmt.Errorf("%w %s: %v", ErrServiceStop, l.args.ConsoleServiceName, err)
+		return result
+	}
+
+	err = l.backup.Restore(ctx)
+	if err != nil {
+		result.RestoreErr = err
+		return result
+	}
+	l.forgetRun()
+
+	err = l.startService(ctx, l.consoleService, consoleCompensation)
+	l.log.LogIfError(err, "Failed to start the console monolithic service after rollback")
+	err = l.startService(ctx, l.netpipeService, netpipeCompensation)
+	l.log.LogIfError(err, "Failed to start the netpipe service after rollback")
+
+	// the database is in the state before the run, so there is nothing to resume
+	l.journal.Complete()
+
+	return result
+}
+
+func (l *Loader) getCompilationPluginArguments() *CommandLine {
+	return NewCommandLine(true).
+		Option("user", l.args.User).
+		SecretOption("password", l.args.Password)
 }
 
-func getIntArgument(key string, value int) string {
-	return fmt.Sprintf(" --%s %d", key, value)
+// getAdminToolsConsoleArguments quotes every value,
+// because AdminToolsConsole has always been called this way
+func (l *Loader) getAdminToolsConsoleArguments(rep string) *CommandLine {
+	return NewCommandLine(true).
+		Option("plugin", "InnerReplicationPlugin").
+		Option("user", l.args.User).
+		SecretOption("password", l.args.Password).
+		Flag("import").
+		Flag("nocompilation").
+		IntOption("verbose", 4).
+		Option("file", rep)
 }
@@ -0,0 +1,475 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/loader"
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+	"github.com/sergeyzalunin/go-replication-loader/schedule"
+)
+
+const (
+	adminToolsConsole = "Akforta.eLeed.AdminToolsConsole.exe"
+	compiler          = "BIZ.Compiler.exe"
+)
+
+// events records actions of fake services and the backup provider in order
+type events []string
+
+func (e *events) add(event string) {
+	*e = append(*e, event)
+}
+
+type fakeService struct {
+	name   string
+	events *events
+}
+
+func (s fakeService) HasService(ctx context.Context) error {
+	return nil
+}
+
+func (s fakeService) State(ctx context.Context) (string, error) {
+	return "Running", nil
+}
+
+func (s fakeService) StartService(ctx context.Context) error {
+	s.events.add("start " + s.name)
+	return nil
+}
+
+func (s fakeService) StopService(ctx context.Context) error {
+	s.events.add("stop " + s.name)
+	return nil
+}
+
+type fakeBackup struct {
+	events *events
+}
+
+func (b fakeBackup) Backup(ctx context.Context) error {
+	b.events.add("backup")
+	return nil
+}
+
+func (b fakeBackup) Restore(ctx context.Context) error {
+	b.events.add("restore")
+	return nil
+}
+
+func (b fakeBackup) DatabaseSize(ctx context.Context) (int64, error) {
+	return 1 << 20, nil
+}
+
+type fakeNotifier struct {
+	reports []loader.RunReport
+}
+
+func (n *fakeNotifier) Notify(report loader.RunReport) error {
+	n.reports = append(n.reports, report)
+	return nil
+}
+
+// fixture is the loader with fake services, tools, backup and notifier
+// installing replications from a temporary directory
+type fixture struct {
+	args     *argsp.ArgumentOptions
+	log      *logger.Log
+	repl     *replication.ReplicationLoader
+	executor *loader.FakeExecutor
+	notifier *fakeNotifier
+	events   *events
+	// now is the clock of maintenance windows, time.Now is used if it isn't set
+	now func() time.Time
+}
+
+func newFixture(t *testing.T, replications ...string) *fixture {
+	t.Helper()
+
+	// the log is written to the log directory of the current one
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	toolsDir, replicationDir := t.TempDir(), t.TempDir()
+	for _, tool := range []string{adminToolsConsole, compiler} {
+		writeFile(t, filepath.Join(toolsDir, tool), "")
+	}
+	for _, name := range replications {
+		writeFile(t, filepath.Join(replicationDir, name), name)
+	}
+
+	f := &fixture{
+		args: &argsp.ArgumentOptions{
+			ProjectName:        "Test",
+			WorkingDirectory:   toolsDir,
+			ConsoleServiceName: "console",
+			NetPipeServiceName: "netpipe",
+			User:               "admin",
+			Password:           "secret",
+			DatabaseName:       "Test",
+			Order:              "sequence",
+		},
+		log:      logger.NewLogger("Test"),
+		executor: loader.NewFakeExecutor(),
+		notifier: &fakeNotifier{},
+		events:   &events{},
+	}
+	// the message makes Close wait until the log file is opened in the temporary directory
+	f.log.Info("Test ", t.Name(), " started")
+	t.Cleanup(func() {
+		f.log.Close()
+		os.Chdir(workDir)
+	})
+
+	f.repl = &replication.ReplicationLoader{}
+	if err = f.repl.Init(f.args.DatabaseName, f.log); err != nil {
+		t.Fatal(err)
+	}
+	f.repl.ReplicationDirectory = replicationDir
+	return f
+}
+
+func (f *fixture) build(t *testing.T) *loader.Loader {
+	t.Helper()
+
+	l, err := loader.NewLoaderBuilder(f.args, f.log).
+		WithConsoleService(fakeService{"console", f.events}).
+		WithNetPipeService(fakeService{"netpipe", f.events}).
+		WithExecutor(f.executor).
+		WithBackupProvider(fakeBackup{f.events}).
+		WithReplicationSource(f.repl).
+		WithNotifier(f.notifier).
+		WithClock(f.now).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func (f *fixture) tools() []string {
+	var result []string
+	for _, call := range f.executor.Calls() {
+		result = append(result, filepath.Base(call.Tool))
+	}
+	return result
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadImportsReplicationsAndCompiles(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.executor.Script(adminToolsConsole, loader.Result{Output: []byte("Imported objects: 3\r\n")})
+
+	hasReplications, err := f.build(t).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !hasReplications {
+		t.Error("Load() hasReplications = false, want true")
+	}
+
+	wantTools := []string{adminToolsConsole, adminToolsConsole, compiler}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v", got, wantTools)
+	}
+
+	wantEvents := events{"stop netpipe", "stop console", "backup", "start console", "start netpipe"}
+	if !reflect.DeepEqual(*f.events, wantEvents) {
+		t.Errorf("events = %v, want %v", *f.events, wantEvents)
+	}
+
+	if len(f.notifier.reports) != 1 {
+		t.Fatalf("reports = %d, want 1", len(f.notifier.reports))
+	}
+	report := f.notifier.reports[0]
+	if report.Err != nil {
+		t.Errorf("report error = %v, want nil", report.Err)
+	}
+	if len(report.Outputs) != 3 || report.Outputs[0].ImportedObjects != 3 {
+		t.Errorf("report outputs = %+v, want 3 outputs with 3 imported objects first", report.Outputs)
+	}
+
+	files, _ := f.repl.GetReplicationFiles()
+	if len(files) != 0 {
+		t.Errorf("replication files left = %v, want none", files)
+	}
+}
+
+func TestLoadWithoutReplicationsDoesNothing(t *testing.T) {
+	f := newFixture(t)
+
+	hasReplications, err := f.build(t).Load(context.Background())
+	if err != nil || hasReplications {
+		t.Fatalf("Load() = %v, %v, want false, nil", hasReplications, err)
+	}
+	if len(f.executor.Calls()) != 0 || len(*f.events) != 0 || len(f.notifier.reports) != 0 {
+		t.Errorf("calls = %v, events = %v, reports = %d, want nothing",
+			f.executor.Calls(), *f.events, len(f.notifier.reports))
+	}
+}
+
+func TestLoadFailsOnCompilationErrorsWithExitCodeZero(t *testing.T) {
+	f := newFixture(t, "0001_first.rep")
+	f.executor.Script(compiler, loader.Result{Output: []byte(
+		"Compiling Forms\\Order.cs\r\nForms\\Order.cs(12,5): error CS1002: ; expected\r\n")})
+
+	_, err := f.build(t).Load(context.Background())
+
+	var compilationErr *loader.CompilationError
+	if !errors.As(err, &compilationErr) {
+		t.Fatalf("Load() error = %v, want CompilationError", err)
+	}
+	want := []loader.CompilationMessage{{File: "Forms\\Order.cs", Line: 12, Message: "; expected"}}
+	if !reflect.DeepEqual(compilationErr.Messages, want) {
+		t.Errorf("compilation messages = %+v, want %+v", compilationErr.Messages, want)
+	}
+
+	// the netpipe service stopped before the compilation is started again by the compensation
+	last := (*f.events)[len(*f.events)-1]
+	if last != "start netpipe" {
+		t.Errorf("last event = %q, want %q", last, "start netpipe")
+	}
+	if len(f.notifier.reports) != 1 || f.notifier.reports[0].Err == nil {
+		t.Errorf("reports = %+v, want one report with the error", f.notifier.reports)
+	}
+}
+
+func TestLoadFailsWhenImportExitCodeIsNotZero(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.executor.Script(adminToolsConsole, loader.Result{}, loader.Result{ExitCode: 3})
+
+	_, err := f.build(t).Load(context.Background())
+
+	var importErr *loader.ImportError
+	if !errors.As(err, &importErr) {
+		t.Fatalf("Load() error = %v, want ImportError", err)
+	}
+	if importErr.ExitCode != 3 || filepath.Base(importErr.File) != "0002_second.rep" {
+		t.Errorf("ImportError = %+v, want the second replication with code 3", importErr)
+	}
+
+	wantTools := []string{adminToolsConsole, adminToolsConsole}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v, the compiler mustn't run", got, wantTools)
+	}
+}
+
+func TestCompileReportsCompilationErrors(t *testing.T) {
+	f := newFixture(t, "0001_first.rep")
+	f.executor.Script(compiler, loader.Result{ExitCode: 2})
+
+	err := f.build(t).Compile(context.Background())
+
+	var compilationErr *loader.CompilationError
+	if !errors.As(err, &compilationErr) || compilationErr.ExitCode != 2 {
+		t.Fatalf("Compile() error = %v, want CompilationError with code 2", err)
+	}
+	wantTools := []string{compiler}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v, replications mustn't be imported", got, wantTools)
+	}
+	wantEvents := events{"stop netpipe", "stop console", "start console", "start netpipe"}
+	if !reflect.DeepEqual(*f.events, wantEvents) {
+		t.Errorf("events = %v, want %v", *f.events, wantEvents)
+	}
+	if len(f.notifier.reports) != 1 || !errors.As(f.notifier.reports[0].Err, &compilationErr) {
+		t.Errorf("reports = %+v, want one report of the compilation error", f.notifier.reports)
+	}
+}
+
+func TestLoadPostponesReplicationsAfterWindowEnd(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep", "0003_third.rep")
+	f.args.MaintenanceWindows = []string{"0 2 * * *"}
+	f.args.WindowLength = 120
+	f.args.WindowMinRemaining = 30
+	// the window ends while the first replication is being imported
+	start := time.Date(2024, time.June, 15, 2, 30, 0, 0, time.Local)
+	f.now = func() time.Time {
+		if len(f.executor.Calls()) > 0 {
+			return start.Add(2 * time.Hour)
+		}
+		return start
+	}
+
+	hasReplications, err := f.build(t).Load(context.Background())
+
+	var outside *schedule.OutsideWindowError
+	if !hasReplications || !errors.As(err, &outside) {
+		t.Fatalf("Load() = %v, %v, want true and OutsideWindowError", hasReplications, err)
+	}
+	if next := time.Date(2024, time.June, 16, 2, 0, 0, 0, time.Local); !outside.Next.Equal(next) {
+		t.Errorf("next window = %v, want %v", outside.Next, next)
+	}
+
+	wantTools := []string{adminToolsConsole, compiler}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v, the imported replication must be compiled", got, wantTools)
+	}
+	wantEvents := events{"stop netpipe", "stop console", "backup", "start console", "start netpipe"}
+	if !reflect.DeepEqual(*f.events, wantEvents) {
+		t.Errorf("events = %v, want %v", *f.events, wantEvents)
+	}
+
+	files, _ := f.repl.GetReplicationFiles()
+	var left []string
+	for _, file := range files {
+		left = append(left, filepath.Base(file))
+	}
+	if want := []string{"0002_second.rep", "0003_third.rep"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("replication files left = %v, want %v", left, want)
+	}
+
+	if len(f.notifier.reports) != 1 || !errors.As(f.notifier.reports[0].Err, &outside) {
+		t.Errorf("reports = %+v, want one report of the postponed run", f.notifier.reports)
+	}
+	var failure *loader.FailureError
+	if errors.As(err, &failure) {
+		t.Errorf("Load() error = %v, want the run postponed, not failed", err)
+	}
+}
+
+// addApplied records the replication file in the history as applied by a previous run under another name
+func (f *fixture) addApplied(t *testing.T, name string) {
+	t.Helper()
+
+	hash, err := replication.FileHash(filepath.Join(f.repl.ReplicationDirectory, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := replication.HistoryRecord{Hash: hash, File: "renamed_" + name, Database: f.args.DatabaseName,
+		RunID: "previous", Time: time.Now().Add(-time.Hour)}
+	if err = replication.NewFileHistory(f.repl.ReplicationDirectory, f.args.DatabaseName).Add(record); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fixture) replicationNames(t *testing.T) []string {
+	t.Helper()
+
+	files, err := f.repl.GetReplicationFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, file := range files {
+		result = append(result, filepath.Base(file))
+	}
+	return result
+}
+
+func TestLoadSkipsAppliedReplicationsAndLeavesThem(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.addApplied(t, "0001_first.rep")
+
+	if _, err := f.build(t).Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	wantTools := []string{adminToolsConsole, compiler}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v, the applied replication mustn't be imported", got, wantTools)
+	}
+	if calls := f.executor.Calls(); !strings.Contains(calls[0].Args, "0002_second.rep") {
+		t.Errorf("imported %s, want 0002_second.rep", calls[0].Args)
+	}
+	if got, want := f.replicationNames(t), []string{"0001_first.rep"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replication files left = %v, want %v", got, want)
+	}
+
+	// the imported replication is found by the content, whatever its name is
+	hash, err := replication.FileHash(filepath.Join(f.repl.ReplicationDirectory, "0001_first.rep"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := replication.NewFileHistory(f.repl.ReplicationDirectory, f.args.DatabaseName).Find(hash)
+	if err != nil || record == nil || record.File != "renamed_0001_first.rep" {
+		t.Errorf("history record = %+v, %v, want the record of the previous run", record, err)
+	}
+}
+
+func TestLoadArchivesAppliedReplicationsIfRequired(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.args.ArchiveApplied = true
+	f.addApplied(t, "0001_first.rep")
+
+	if _, err := f.build(t).Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	wantTools := []string{adminToolsConsole, compiler}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v", got, wantTools)
+	}
+	if got := f.replicationNames(t); len(got) != 0 {
+		t.Errorf("replication files left = %v, want none", got)
+	}
+}
+
+func TestLoadImportsAppliedReplicationsWithForce(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.args.Force = true
+	f.addApplied(t, "0001_first.rep")
+
+	if _, err := f.build(t).Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	wantTools := []string{adminToolsConsole, adminToolsConsole, compiler}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v, -force imports the applied replication", got, wantTools)
+	}
+	if got := f.replicationNames(t); len(got) != 0 {
+		t.Errorf("replication files left = %v, want none", got)
+	}
+}
+
+func TestLoadArchivesDescriptionsWithReplications(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.args.ArchiveMode = "move"
+	dir := f.repl.ReplicationDirectory
+	writeFile(t, filepath.Join(dir, "0001_first.desc"), "Task 1")
+	writeFile(t, filepath.Join(dir, "0003_third.desc"), "Task 3")
+
+	l := f.build(t)
+	if _, err := l.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for _, name := range []string{"0001_first.rep", "0001_first.desc", "0002_second.rep"} {
+		if _, err := os.Stat(filepath.Join(dir, "archive", l.RunID(), name)); err != nil {
+			t.Errorf("%s isn't archived: %v", name, err)
+		}
+	}
+	// the description of the replication which wasn't installed is left
+	if _, err := os.Stat(filepath.Join(dir, "0003_third.desc")); err != nil {
+		t.Errorf("the description without replication is archived: %v", err)
+	}
+
+	if len(f.notifier.reports) != 1 {
+		t.Fatalf("reports = %d, want 1", len(f.notifier.reports))
+	}
+	if got, want := f.notifier.reports[0].Descriptions, []string{"Task 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("report descriptions = %v, want %v", got, want)
+	}
+}
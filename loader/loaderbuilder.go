@@ -1,55 +1,166 @@
 package loader
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
 	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/mssql"
+	"github.com/sergeyzalunin/go-replication-loader/replication"
 	"github.com/sergeyzalunin/go-replication-loader/services"
 )
 
-// Builder serves to construct a process of installing replications
+// ErrIncompleteLoader is returned by Build when required parts of the loader aren't set
+var ErrIncompleteLoader = errors.New("the loader is incomplete")
+
+// Builder serves to construct a process of installing replications.
+// An embedding program can replace any part of the loader,
+// the rest is taken from the arguments by WithDefaults.
 type Builder struct {
 	loader Loader
-	log    *logger.Log
+	runner Executor
+	errs   []error
 }
 
 // NewLoaderBuilder is a constructor for Builder
-func NewLoaderBuilder(log *logger.Log) *Builder {
-	return &Builder{Loader{}, log}
+func NewLoaderBuilder(args *argsp.ArgumentOptions, log *logger.Log) *Builder {
+	return &Builder{loader: Loader{args: args, log: log}}
 }
 
-// AddCMS allows to get console monolithic service by its name
-func (b *Builder) AddCMS(serviceName string) {
-	service, err := getService(serviceName, b.log)
-	if err != nil {
-		panic(err)
-	}
+// WithConsoleService sets the console monolithic service
+func (b *Builder) WithConsoleService(service services.IService) *Builder {
 	b.loader.consoleService = service
+	return b
+}
+
+// WithNetPipeService sets the netpipe service
+func (b *Builder) WithNetPipeService(service services.IService) *Builder {
+	b.loader.netpipeService = service
+	return b
+}
+
+// WithExecutor sets the runner of eLeed tools, e.g. FakeExecutor in tests
+func (b *Builder) WithExecutor(runner Executor) *Builder {
+	b.runner = runner
+	return b
+}
+
+// WithBackupProvider sets the provider making the backup of database and restoring it
+func (b *Builder) WithBackupProvider(backup mssql.BackupProvider) *Builder {
+	b.loader.backup = backup
+	return b
+}
+
+// WithReplicationSource sets the source of replications
+func (b *Builder) WithReplicationSource(repl ReplicationSource) *Builder {
+	b.loader.repl = repl
+	return b
+}
+
+// WithNotifier sets the notifier of run results, the loader doesn't notify if it isn't set
+func (b *Builder) WithNotifier(notifier Notifier) *Builder {
+	b.loader.notifier = notifier
+	return b
+}
+
+// WithClock sets the clock maintenance windows are checked by, time.Now is used if it isn't set
+func (b *Builder) WithClock(now func() time.Time) *Builder {
+	b.loader.now = now
+	return b
+}
+
+// WithPreflightCheck adds the check which runs before any service is stopped
+func (b *Builder) WithPreflightCheck(name string, check PreflightCheck) *Builder {
+	b.loader.AddPreflightCheck(name, check)
+	return b
 }
 
-// AddNetPipe allows to get netpipe service by its name
-func (b *Builder) AddNetPipe(serviceName string) {
-	if serviceName == "" {
-		return
+// WithDefaults sets parts which aren't set yet from the arguments:
+// services of the operating system, eLeed tools, MSSQL backup and the replication directory.
+// Services and tools only report what they would do in dry run mode.
+func (b *Builder) WithDefaults() *Builder {
+	args, log := b.loader.args, b.loader.log
+	if args == nil || log == nil {
+		return b
 	}
 
-	service, err := getService(serviceName, b.log)
-	if err != nil {
-		panic(err)
+	if b.loader.repl == nil {
+		repl := &replication.ReplicationLoader{}
+		if err := repl.Init(args.DatabaseName, log); err != nil {
+			b.errs = append(b.errs, err)
+		} else {
+			b.loader.repl = repl
+		}
 	}
 
-	b.loader.netpipeService = service
-}
+	if b.runner == nil {
+		b.runner = NewOSExecutor()
+	}
 
-// Build the replication loader
-func (b *Builder) Build() Loader {
-	b.log.Info("Replication(s) ", b, " is in the directory")
-	return b.loader
+	newService := services.NewService
+	if args.DryRun {
+		log.Info("[dry run] Nothing will be changed, the installation plan is printed only")
+		newService = services.NewDryRunService
+	}
+	if b.loader.consoleService == nil {
+		b.loader.consoleService = newService(args.ConsoleServiceName, log)
+	}
+	if b.loader.netpipeService == nil {
+		b.loader.netpipeService = newService(args.NetPipeServiceName, log)
+	}
+
+	if b.loader.backup == nil {
+		b.loader.backup = mssql.NewBackupProvider(args, log)
+	}
+	return b
 }
 
-func getService(serviceName string, log *logger.Log) (services.IService, error) {
-	service := services.NewService(serviceName, log)
-	if err := service.HasService(); err != nil {
-		log.Error(err)
-		return service, err
+// Build checks that all required parts are set and returns the loader
+func (b *Builder) Build() (*Loader, error) {
+	if len(b.errs) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrIncompleteLoader, b.errs[0])
+	}
+
+	var missing []string
+	required := []struct {
+		name  string
+		isSet bool
+	}{
+		{"arguments", b.loader.args != nil},
+		{"log", b.loader.log != nil},
+		{"replication source", b.loader.repl != nil},
+		{"executor", b.runner != nil},
+		{"console monolithic service", b.loader.consoleService != nil},
+		{"netpipe service", b.loader.netpipeService != nil},
+		{"backup provider", b.loader.backup != nil},
+	}
+	for _, part := range required {
+		if !part.isSet {
+			missing = append(missing, part.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w, not set: %s", ErrIncompleteLoader, strings.Join(missing, ", "))
+	}
+
+	failPatterns, err := CompileFailPatterns(b.loader.args.FailPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	l := b.loader
+	if l.now == nil {
+		l.now = time.Now
 	}
-	return service, nil
+	l.executor = NewProcessExecutor(l.args.WorkingDirectory, l.log)
+	l.executor.FailPatterns = failPatterns
+	l.executor.DryRun = l.args.DryRun
+	l.executor.Runner = b.runner
+	l.executor.ImportTimeout = time.Duration(l.args.ImportTimeout) * time.Minute
+	l.executor.CompilationTimeout = time.Duration(l.args.CompilationTimeout) * time.Minute
+	l.compensations = newCompensationStack(l.log)
+	return &l, nil
 }
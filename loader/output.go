@@ -0,0 +1,130 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	errorLine   = regexp.MustCompile(`(?i)\berror\b`)
+	warningLine = regexp.MustCompile(`(?i)\bwarning\b`)
+	// e.g. "Imported objects: 15" or "15 objects imported"
+	importedCount = regexp.MustCompile(`(?i)imported\s+objects\s*[:=]?\s*(\d+)|(\d+)\s+objects?\s+(?:were\s+)?imported`)
+	// e.g. "Forms\Order.cs(12,5): error CS1002: ; expected" or "Order.biz:12: error: unknown type"
+	compilationMessage = regexp.MustCompile(`^(.+?)(?:\((\d+)(?:,\d+)?\)|:(\d+)):\s*error\b[^:]*:\s*(.*)$`)
+)
+
+// CompilationMessage is an error of BIZ.Compiler pointing to the source
+type CompilationMessage struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// ToolOutput is the parsed output of a tool run
+type ToolOutput struct {
+	Tool string
+	// Replication is the file imported by the run, empty for the compilation
+	Replication       string
+	Errors            []string
+	Warnings          []string
+	ImportedObjects   int
+	CompilationErrors []CompilationMessage
+	// Failures are lines matched by fail patterns
+	Failures []string
+}
+
+// ParseOutput extracts errors, warnings, imported objects and compilation errors from the output.
+// Lines matching any of the fail patterns are collected as failures.
+func ParseOutput(tool, replication string, output []byte, failPatterns []*regexp.Regexp) ToolOutput {
+	result := ToolOutput{Tool: tool, Replication: replication}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		result.parseLine(line)
+
+		for _, pattern := range failPatterns {
+			if pattern.MatchString(line) {
+				result.Failures = append(result.Failures, line)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (o *ToolOutput) parseLine(line string) {
+	if m := compilationMessage.FindStringSubmatch(line); m != nil {
+		lineNumber := m[2]
+		if lineNumber == "" {
+			lineNumber = m[3]
+		}
+		n, _ := strconv.Atoi(lineNumber)
+		o.CompilationErrors = append(o.CompilationErrors, CompilationMessage{strings.TrimSpace(m[1]), n, m[4]})
+	}
+
+	switch {
+	case errorLine.MatchString(line):
+		o.Errors = append(o.Errors, line)
+	case warningLine.MatchString(line):
+		o.Warnings = append(o.Warnings, line)
+	}
+
+	if m := importedCount.FindStringSubmatch(line); m != nil {
+		count := m[1]
+		if count == "" {
+			count = m[2]
+		}
+		n, _ := strconv.Atoi(count)
+		o.ImportedObjects += n
+	}
+}
+
+// Failed returns true if the output matched any fail pattern
+func (o ToolOutput) Failed() bool {
+	return len(o.Failures) > 0
+}
+
+// Summary describes the output in a few lines for the report
+func (o ToolOutput) Summary() string {
+	name := o.Tool
+	if o.Replication != "" {
+		name += " " + o.Replication
+	}
+
+	result := &strings.Builder{}
+	fmt.Fprintf(result, "%s: %d error(s), %d warning(s)", name, len(o.Errors), len(o.Warnings))
+	if o.ImportedObjects > 0 {
+		fmt.Fprintf(result, ", %d object(s) imported", o.ImportedObjects)
+	}
+	for _, m := range o.CompilationErrors {
+		fmt.Fprintf(result, "\r\n\t%s(%d): %s", m.File, m.Line, m.Message)
+	}
+	for _, line := range o.Failures {
+		fmt.Fprintf(result, "\r\n\tfailure: %s", line)
+	}
+	return result.String()
+}
+
+// CompileFailPatterns compiles patterns which fail the run when the tool output matches them.
+// Patterns are case insensitive regular expressions.
+func CompileFailPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var result []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("fail pattern %q is invalid: %v", pattern, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package loader_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergeyzalunin/go-replication-loader/loader"
+)
+
+// readOutput reads the console output of a tool captured in testdata
+func readOutput(t *testing.T, name string) []byte {
+	t.Helper()
+	output, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestParseImportOutput(t *testing.T) {
+	got := loader.ParseOutput(adminToolsConsole, "0001_orders.rep", readOutput(t, "admintools_import.txt"), nil)
+
+	want := loader.ToolOutput{
+		Tool:        adminToolsConsole,
+		Replication: "0001_orders.rep",
+		Warnings: []string{
+			"Warning: the object Forms.Order is locked by user ivanov, it is overwritten",
+		},
+		ImportedObjects: 18,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOutput() = %+v, want %+v", got, want)
+	}
+	if got.Failed() {
+		t.Error("Failed() = true without fail patterns")
+	}
+}
+
+func TestParseCompilerOutput(t *testing.T) {
+	got := loader.ParseOutput(compiler, "", readOutput(t, "compiler_errors.txt"), nil)
+
+	wantMessages := []loader.CompilationMessage{
+		{File: "Forms\\Order.cs", Line: 12, Message: "; expected"},
+		{File: "Forms\\Order.cs", Line: 40, Message: "The name 'total' does not exist in the current context"},
+		{File: "Scripts\\Price.biz", Line: 7, Message: "unknown type Money"},
+	}
+	if !reflect.DeepEqual(got.CompilationErrors, wantMessages) {
+		t.Errorf("CompilationErrors = %+v, want %+v", got.CompilationErrors, wantMessages)
+	}
+	if len(got.Errors) != 3 || len(got.Warnings) != 1 || got.ImportedObjects != 0 {
+		t.Errorf("ParseOutput() = %d errors, %d warnings, %d objects, want 3, 1, 0",
+			len(got.Errors), len(got.Warnings), got.ImportedObjects)
+	}
+
+	summary := got.Summary()
+	for _, want := range []string{"3 error(s), 1 warning(s)", "Scripts\\Price.biz(7): unknown type Money"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary() = %q, want it to contain %q", summary, want)
+		}
+	}
+}
+
+func TestParseOutputFailPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			name: "no patterns",
+		},
+		{
+			name:     "case insensitive",
+			patterns: []string{"EXCEPTION"},
+			want:     []string{"Unhandled exception: System.Data.SqlClient.SqlException: Timeout expired"},
+		},
+		{
+			name:     "line matching several patterns is reported once",
+			patterns: []string{"exception", `timeout\s+expired`},
+			want:     []string{"Unhandled exception: System.Data.SqlClient.SqlException: Timeout expired"},
+		},
+		{
+			name:     "several lines",
+			patterns: []string{"^warning:", "^done$"},
+			want: []string{
+				"Warning: the object Forms.Order is locked by user ivanov, it is overwritten",
+				"Done",
+			},
+		},
+		{
+			name:     "no match",
+			patterns: []string{"deadlock"},
+		},
+	}
+
+	output := readOutput(t, "admintools_import.txt")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns, err := loader.CompileFailPatterns(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := loader.ParseOutput(adminToolsConsole, "0001_orders.rep", output, patterns)
+			if !reflect.DeepEqual(got.Failures, tt.want) {
+				t.Errorf("Failures = %q, want %q", got.Failures, tt.want)
+			}
+			if got.Failed() != (len(tt.want) > 0) {
+				t.Errorf("Failed() = %t, want %t", got.Failed(), len(tt.want) > 0)
+			}
+		})
+	}
+}
+
+func TestCompileFailPatternsInvalid(t *testing.T) {
+	if _, err := loader.CompileFailPatterns([]string{"exception", "(unclosed"}); err == nil {
+		t.Error("CompileFailPatterns() error = nil, want the invalid pattern reported")
+	}
+}
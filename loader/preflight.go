@@ -0,0 +1,139 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// PreflightCheck checks a resource the installation needs
+type PreflightCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check PreflightCheck
+}
+
+// AddPreflightCheck adds the check which runs before any service is stopped
+// together with checks of the loader itself
+func (l *Loader) AddPreflightCheck(name string, check PreflightCheck) {
+	l.checks = append(l.checks, namedCheck{name, check})
+}
+
+// preflight checks everything the installation needs before any service is stopped.
+// All checks run, so all problems are reported at once.
+func (l *Loader) preflight(ctx context.Context) error {
+	checks := []namedCheck{
+		{"AdminToolsConsole", fileExists(l.executor.AdminToolsConsolePath())},
+		{"BIZ.Compiler", fileExists(l.executor.CompilerPath())},
+		{"Console monolithic service", l.consoleService.HasService},
+		{"SQL Server and backup path", l.checkDatabase},
+	}
+	if l.args.NetPipeServiceName != "" {
+		checks = append(checks, namedCheck{"Netpipe service", l.netpipeService.HasService})
+	}
+	checks = append(checks, l.checks...)
+
+	result := &PreflightError{}
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			l.log.Error(err, "Pre-flight check failed: ", c.name)
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: %v", c.name, err))
+			continue
+		}
+		l.log.Info("Pre-flight check passed: ", c.name)
+	}
+
+	if len(result.Failures) > 0 {
+		return result
+	}
+	return nil
+}
+
+func fileExists(path string) PreflightCheck {
+	return func(ctx context.Context) error {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		return nil
+	}
+}
+
+// checkDatabase checks that SQL Server is reachable
+// and the backup path has enough free space for the backup of database.
+// BACKUP writes the file on the SQL Server host, so the path is checked only if the server is local.
+func (l *Loader) checkDatabase(ctx context.Context) error {
+	size, err := l.backup.DatabaseSize(ctx)
+	if err != nil {
+		return fmt.Errorf("SQL Server isn't reachable: %v", err)
+	}
+
+	// the compile command doesn't open the journal, because it makes no backup
+	if l.journal == nil || l.args.SkipBackup || l.journal.Done(StepBackupDone) || l.args.BackupPath == "" {
+		return nil
+	}
+	if !isLocalDataSource(l.args.DbDataSource) {
+		l.log.Info("Warning: the backup path ", l.args.BackupPath, " isn't checked, because it is on the SQL Server host ",
+			l.args.DbDataSource, ". It must have ", size>>20, " MB free")
+		return nil
+	}
+	return checkBackupPath(l.args.BackupPath, uint64(size))
+}
+
+// isLocalDataSource returns true if the data source is SQL Server of this host,
+// e.g. ".", "(local)\SQLEXPRESS", "tcp:localhost,1433" or the host name
+func isLocalDataSource(dataSource string) bool {
+	server := strings.ToLower(strings.TrimSpace(dataSource))
+	for _, protocol := range []string{"tcp:", "np:", "lpc:"} {
+		server = strings.TrimPrefix(server, protocol)
+	}
+	if i := strings.IndexAny(server, `\,`); i >= 0 {
+		server = server[:i]
+	}
+
+	switch server {
+	case "", ".", "(local)", "localhost", "127.0.0.1", "::1", "[::1]":
+		return true
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return false
+	}
+	host = strings.ToLower(host)
+	return server == host || strings.SplitN(server, ".", 2)[0] == strings.SplitN(host, ".", 2)[0]
+}
+
+// checkBackupPath checks that the directory exists, is writable and has the space
+func checkBackupPath(path string, required uint64) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("backup path %s isn't a directory", path)
+	}
+
+	file, err := ioutil.TempFile(path, "preflight-*.tmp")
+	if err != nil {
+		return fmt.Errorf("backup path %s isn't writable: %v", path, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	available, err := freeSpace(path)
+	if err != nil {
+		return fmt.Errorf("free space of %s couldn't be read: %v", path, err)
+	}
+	if available < required {
+		return fmt.Errorf("backup path %s has %d MB free, but the database takes %d MB",
+			path, available>>20, required>>20)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package loader
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIsLocalDataSource(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dataSource string
+		want       bool
+	}{
+		{"", true},
+		{".", true},
+		{`.\SQLEXPRESS`, true},
+		{"(local)", true},
+		{`(LOCAL)\SQLEXPRESS`, true},
+		{"localhost", true},
+		{"tcp:localhost,1433", true},
+		{"np:127.0.0.1", true},
+		{host, true},
+		{strings.ToUpper(host) + `\MSSQL`, true},
+		{"sql-cluster", false},
+		{`db.example.com\PROD`, false},
+		{"tcp:10.0.0.5,1433", false},
+	}
+
+	for _, tt := range tests {
+		if got := isLocalDataSource(tt.dataSource); got != tt.want {
+			t.Errorf("isLocalDataSource(%q) = %t, want %t", tt.dataSource, got, tt.want)
+		}
+	}
+}
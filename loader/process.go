@@ -1,10 +1,12 @@
 package loader
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"path/filepath"
-	"syscall"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/sergeyzalunin/go-replication-loader/logger"
 )
@@ -14,7 +16,19 @@ type ProcessExecutor struct {
 	log                      *logger.Log
 	PathToAdminToolsConsole  string
 	PathToCompilationPluting string
-	dir                      string
+	// DryRun only prints command lines instead of running processes
+	DryRun bool
+	dir    string
+	// Runner starts processes, it's replaced by FakeExecutor in tests
+	Runner Executor
+	// ImportTimeout limits the import of a replication, 0 means no limit
+	ImportTimeout time.Duration
+	// CompilationTimeout limits the compilation, 0 means no limit
+	CompilationTimeout time.Duration
+	// FailPatterns fail the run if the output matches them even if the exit code is 0
+	FailPatterns []*regexp.Regexp
+	// Outputs are parsed outputs of all tool runs
+	Outputs []ToolOutput
 }
 
 // NewProcessExecutor is a ProcessExecutor factory
@@ -23,61 +37,115 @@ func NewProcessExecutor(workingDirectory string, log *logger.Log) *ProcessExecut
 		log,
 		filepath.Join(workingDirectory, "Akforta.eLeed.AdminToolsConsole.exe"),
 		filepath.Join(workingDirectory, "BIZ.Compiler.exe"),
+		false,
 		workingDirectory,
+		NewOSExecutor(),
+		0,
+		0,
+		nil,
+		nil,
 	}
 }
 
-// RunAdminToolsConsole starts the installation process
-func (p *ProcessExecutor) RunAdminToolsConsole(args string) {
-	p.run(p.PathToAdminToolsConsole, args)
+// AdminToolsConsolePath returns the path to Akforta.eLeed.AdminToolsConsole.exe
+func (p *ProcessExecutor) AdminToolsConsolePath() string {
+	return p.PathToAdminToolsConsole
+}
+
+// CompilerPath returns the path to BIZ.Compiler.exe
+func (p *ProcessExecutor) CompilerPath() string {
+	return p.PathToCompilationPluting
+}
+
+// RunAdminToolsConsole starts the installation process of the replication
+func (p *ProcessExecutor) RunAdminToolsConsole(ctx context.Context, rep string, args *CommandLine) error {
+	return p.run(ctx, p.PathToAdminToolsConsole, args, p.ImportTimeout, filepath.Base(rep))
 }
 
 // RunCompilationPluting starts the compilation process
-func (p *ProcessExecutor) RunCompilationPluting(args string) {
-	p.run(p.PathToCompilationPluting, args)
+func (p *ProcessExecutor) RunCompilationPluting(ctx context.Context, args *CommandLine) error {
+	return p.run(ctx, p.PathToCompilationPluting, args, p.CompilationTimeout, "")
 }
 
-func (p *ProcessExecutor) run(filename string, args string) {
-	if _, err := exec.LookPath(filename); err == nil {
-		cmd := exec.Command(filename)
-
-		// Filename + args sets directly due to avoid auto arguments escaping.
-		// Akforta.eLeed.AdminToolsConsole.exe can't handle escaped arguments
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			HideWindow: true,
-			CmdLine: fmt.Sprintf(`"%s" %s`,  filename, args),
-		}
-		p.log.Info(cmd.SysProcAttr.CmdLine)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			p.logProcess(output, cmd, err)
-			panic(err)
-		}
-		p.logProcess(output, cmd, nil)
-		p.eleedSpecificCheckings(filename, cmd.ProcessState.ExitCode())
-	} else {
-		p.logProcess([]byte{}, nil, err)
-		panic(err)
+// run starts the process and waits for its completion.
+// The output is written to the log line by line tagged with the tool and the replication as it arrives,
+// then it's parsed and checked against fail patterns.
+// The process tree is killed if the context is cancelled or the timeout is exceeded.
+func (p *ProcessExecutor) run(ctx context.Context, filename string, args *CommandLine, timeout time.Duration, rep string) error {
+	// secrets are masked, because the command line is logged
+	cmdLine := fmt.Sprintf(`"%s" %s`, filename, args.Masked())
+	if p.DryRun {
+		p.log.Info("[dry run] ", cmdLine)
+		return nil
 	}
-}
 
-func (p *ProcessExecutor) logProcess(output []byte, cmd *exec.Cmd, err error) {
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	tool := filepath.Base(filename)
+	tag := strings.TrimSpace(tool + " " + rep)
+
+	p.log.Info(cmdLine)
+	output := p.log.NewLineWriter(tag)
+	result, err := p.Runner.Run(runCtx, filename, args, output)
+	output.Close()
+	p.logProcess(result, err)
+
+	parsed := ParseOutput(tool, rep, result.Output, p.FailPatterns)
+	p.Outputs = append(p.Outputs, parsed)
 	if err == nil {
-		p.log.Info(string(output))
-	} else {
-		p.log.Error(err, string(output))
+		err = p.eleedSpecificCheckings(filename, result.ExitCode, parsed)
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		err = &interruptedError{ctx.Err()}
+	case runCtx.Err() != nil:
+		err = &TimeoutError{tool, timeout}
+	}
+	if err != nil {
+		return &ProcessError{tool, result.ExitCode, err}
+	}
+	return nil
+}
+
+// logProcess logs the result, the output has been already logged while the process was running
+func (p *ProcessExecutor) logProcess(result Result, err error) {
+	if err != nil {
+		p.log.Error(err)
 	}
 
-	if cmd != nil {
-		p.log.Info("exit code: ", cmd.ProcessState.ExitCode())
+	if result.ExitCode >= 0 {
+		p.log.Info("exit code: ", result.ExitCode)
 	}
 }
 
-func (p *ProcessExecutor) eleedSpecificCheckings(filename string, exitCode int) {
-	msg := fmt.Sprintf("The execution of the programm %s was completed with code %d", filename, exitCode)
-	if filename == p.PathToCompilationPluting && exitCode != 0 {
-		p.log.Error(fmt.Errorf(msg))
-	} else {
-		p.log.Info(msg)
+// eleedSpecificCheckings fails the run completed with the exit code 0
+// if the output matches fail patterns or BIZ.Compiler reports compilation errors
+func (p *ProcessExecutor) eleedSpecificCheckings(filename string, exitCode int, output ToolOutput) error {
+	var err error
+	switch {
+	case output.Failed():
+		err = &OutputError{output.Tool, output.Failures}
+	case filename == p.PathToCompilationPluting && len(output.CompilationErrors) > 0:
+		err = fmt.Errorf("%w, %s reported %d error(s)", ErrCompilationFailed, output.Tool, len(output.CompilationErrors))
+	}
+	if err != nil {
+		p.log.Error(err)
+		return err
+	}
+
+	p.log.Info(fmt.Sprintf("The execution of the programm %s was completed with code %d", filename, exitCode))
+	return nil
+}
+
+// lastOutput returns the parsed output of the last tool run
+func (p *ProcessExecutor) lastOutput() ToolOutput {
+	if len(p.Outputs) == 0 {
+		return ToolOutput{}
 	}
+	return p.Outputs[len(p.Outputs)-1]
 }
@@ -0,0 +1,64 @@
+package loader_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sergeyzalunin/go-replication-loader/loader"
+)
+
+func TestLoadRollsBackAfterFailedImport(t *testing.T) {
+	f := newFixture(t, "0001_first.rep", "0002_second.rep")
+	f.args.Rollback = true
+	f.executor.Script(adminToolsConsole, loader.Result{}, loader.Result{ExitCode: 1})
+
+	_, err := f.build(t).Load(context.Background())
+
+	var rollbackErr *loader.RollbackError
+	if !errors.As(err, &rollbackErr) {
+		t.Fatalf("Load() error = %v, want RollbackError", err)
+	}
+	if !rollbackErr.IsRolledBack() {
+		t.Errorf("RollbackError.RestoreErr = %v, want the database restored", rollbackErr.RestoreErr)
+	}
+	var importErr *loader.ImportError
+	if !errors.As(err, &importErr) {
+		t.Errorf("Load() error = %v, want ImportError as the cause of rollback", err)
+	}
+
+	wantEvents := events{
+		"stop netpipe", "stop console", "backup", "start console",
+		"stop console", "restore", "start console", "start netpipe",
+	}
+	if !reflect.DeepEqual(*f.events, wantEvents) {
+		t.Errorf("events = %v, want %v", *f.events, wantEvents)
+	}
+
+	wantTools := []string{adminToolsConsole, adminToolsConsole}
+	if got := f.tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("tools = %v, want %v, the compiler mustn't run", got, wantTools)
+	}
+
+	if len(f.notifier.reports) != 1 || !errors.As(f.notifier.reports[0].Err, &rollbackErr) {
+		t.Errorf("reports = %+v, want one report of the rollback", f.notifier.reports)
+	}
+}
+
+func TestLoadDoesNotRollBackWithoutPolicy(t *testing.T) {
+	f := newFixture(t, "0001_first.rep")
+	f.executor.Script(adminToolsConsole, loader.Result{ExitCode: 1})
+
+	_, err := f.build(t).Load(context.Background())
+
+	var rollbackErr *loader.RollbackError
+	if err == nil || errors.As(err, &rollbackErr) {
+		t.Fatalf("Load() error = %v, want the import error without rollback", err)
+	}
+	for _, event := range *f.events {
+		if event == "restore" {
+			t.Errorf("events = %v, want no restore", *f.events)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// +build !windows
+
+package loader
+
+import "fmt"
+
+// fileVersion isn't supported, because version resources exist on Windows only
+func fileVersion(path string) (string, error) {
+	return "", fmt.Errorf("version of %s can be read on Windows only", path)
+}
@@ -0,0 +1,49 @@
+package loader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	versionDLL                 = syscall.NewLazyDLL("version.dll")
+	procGetFileVersionInfoSize = versionDLL.NewProc("GetFileVersionInfoSizeW")
+	procGetFileVersionInfo     = versionDLL.NewProc("GetFileVersionInfoW")
+	procVerQueryValue          = versionDLL.NewProc("VerQueryValueW")
+)
+
+// fileVersion reads the file version from the version resource of the executable
+func fileVersion(path string) (string, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+
+	size, _, err := procGetFileVersionInfoSize.Call(uintptr(unsafe.Pointer(name)), 0)
+	if size == 0 {
+		return "", fmt.Errorf("version of %s couldn't be read: %v", path, err)
+	}
+
+	data := make([]byte, size)
+	ok, _, err := procGetFileVersionInfo.Call(uintptr(unsafe.Pointer(name)), 0, size, uintptr(unsafe.Pointer(&data[0])))
+	if ok == 0 {
+		return "", fmt.Errorf("version of %s couldn't be read: %v", path, err)
+	}
+
+	root, _ := syscall.UTF16PtrFromString(`\`)
+	var info uintptr
+	var length uint32
+	ok, _, err = procVerQueryValue.Call(uintptr(unsafe.Pointer(&data[0])), uintptr(unsafe.Pointer(root)),
+		uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&length)))
+	if ok == 0 || length == 0 {
+		return "", fmt.Errorf("version of %s couldn't be read: %v", path, err)
+	}
+
+	// VS_FIXEDFILEINFO points into data, dwFileVersionMS and dwFileVersionLS follow the signature and the structure version
+	offset := info - uintptr(unsafe.Pointer(&data[0]))
+	ms := binary.LittleEndian.Uint32(data[offset+8:])
+	ls := binary.LittleEndian.Uint32(data[offset+12:])
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff), nil
+}
@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"bytes"
+	"sync"
+)
+
+// LineWriter writes the stream to the log line by line as lines arrive.
+// Each line is prefixed by the tag, e.g. the name of the tool producing the output.
+type LineWriter struct {
+	log     Log
+	tag     string
+	mu      sync.Mutex
+	pending []byte
+}
+
+// NewLineWriter is a constructor for LineWriter
+func (l Log) NewLineWriter(tag string) *LineWriter {
+	return &LineWriter{log: l, tag: tag}
+}
+
+// Write logs complete lines and keeps the rest until the next write.
+// Carriage returns are line breaks too, because tools print progress with them.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexAny(w.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close logs the last line if it doesn't end with a line break
+func (w *LineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writeLine(w.pending)
+	w.pending = nil
+	return nil
+}
+
+func (w *LineWriter) writeLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	w.log.Info("[", w.tag, "] ", string(line))
+}
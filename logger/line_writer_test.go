@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// messages returns texts of log lines without the time and the level
+func messages(lines []string) []string {
+	var result []string
+	for _, line := range lines {
+		if i := strings.Index(line, "]: "); i >= 0 {
+			line = line[i+len("]: "):]
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{
+			name:   "lines split between writes",
+			writes: []string{"Import", "ing Forms", ".Order\nImported ", "objects: 3\n"},
+			want:   []string{"[tool] Importing Forms.Order", "[tool] Imported objects: 3"},
+		},
+		{
+			name:   "CRLF",
+			writes: []string{"first\r\nsecond\r", "\nthird\r\n"},
+			want:   []string{"[tool] first", "[tool] second", "[tool] third"},
+		},
+		{
+			name:   "progress by carriage returns",
+			writes: []string{"10%\r20%\r", "100%\n"},
+			want:   []string{"[tool] 10%", "[tool] 20%", "[tool] 100%"},
+		},
+		{
+			name:   "last line without line break is written on close",
+			writes: []string{"first\nCompilation fin", "ished"},
+			want:   []string{"[tool] first", "[tool] Compilation finished"},
+		},
+		{
+			name:   "empty lines are skipped",
+			writes: []string{"\n\n  \nfirst\n\n"},
+			want:   []string{"[tool] first"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newTestLog(t)
+			w := log.NewLineWriter("tool")
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			w.Close()
+
+			if got := messages(readLog(t, log)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("log = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineWriterInterleavedStreams(t *testing.T) {
+	log := newTestLog(t)
+	// stdout and stderr of the tool share the writer, two tools run at once have different tags
+	first, second := log.NewLineWriter("AdminToolsConsole.exe 0001.rep"), log.NewLineWriter("BIZ.Compiler.exe")
+
+	var want []string
+	var wg sync.WaitGroup
+	for _, w := range []*LineWriter{first, second} {
+		for _, stream := range []string{"stdout", "stderr"} {
+			for i := 0; i < 20; i++ {
+				want = append(want, fmt.Sprintf("[%s] %s line %d", w.tag, stream, i))
+			}
+
+			wg.Add(1)
+			go func(w *LineWriter, stream string) {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					w.Write([]byte(fmt.Sprintf("%s line %d\r\n", stream, i)))
+				}
+			}(w, stream)
+		}
+	}
+	wg.Wait()
+	first.Close()
+	second.Close()
+
+	got := messages(readLog(t, log))
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("log = %q, want every line once with the tag of its writer", got)
+	}
+}
@@ -15,6 +15,7 @@ type Log struct {
 	logFile string
 	ch      chan string
 	wg      *sync.WaitGroup
+	secrets *secrets
 }
 
 // NewLogger is the default constructor to create logger
@@ -27,6 +28,7 @@ func NewLogger(projectName string) *Log {
 		logFile: getFileName(projectName),
 		ch:      make(chan string, 5),
 		wg:      &sync.WaitGroup{},
+		secrets: &secrets{},
 	}
 	go logger.write()
 	return &logger
@@ -106,7 +108,8 @@ func (l Log) Fatal(err error, message ...interface{}) {
 
 func (l Log) log(level Level, message ...interface{}) {
 	l.wg.Add(1)
-	l.ch <- getMessage(level, message...)
+	// only the text is masked, so short secrets don't spoil the time and the level
+	l.ch <- getMessage(level, l.Mask(fmt.Sprint(message...)))
 }
 
 func getErrorMessage(err error) string {
@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+)
+
+// MaskedValue replaces secrets in messages
+const MaskedValue = "***"
+
+// secrets are values which never get into the log, the console or emails
+type secrets struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// AddSecret registers values which are replaced by the mask in every message written after it.
+// Empty values are ignored.
+func (l Log) AddSecret(values ...string) {
+	if l.secrets == nil {
+		return
+	}
+	l.secrets.add(values)
+}
+
+// Mask replaces registered secrets in the text, e.g. in the body of email
+func (l Log) Mask(text string) string {
+	if l.secrets == nil {
+		return text
+	}
+	return l.secrets.mask(text)
+}
+
+func (s *secrets) add(values []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, value := range values {
+		if value != "" && !contains(s.values, value) {
+			s.values = append(s.values, value)
+		}
+	}
+}
+
+// mask replaces every run of the text covered by secrets with a single mask,
+// so overlapping secrets or a secret containing another one leave no part of them
+func (s *secrets) mask(text string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var covered []bool
+	for _, value := range s.values {
+		for start := 0; start < len(text); {
+			i := strings.Index(text[start:], value)
+			if i < 0 {
+				break
+			}
+			if covered == nil {
+				covered = make([]bool, len(text))
+			}
+			for j := start + i; j < start+i+len(value); j++ {
+				covered[j] = true
+			}
+			start += i + 1
+		}
+	}
+	if covered == nil {
+		return text
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch {
+		case !covered[i]:
+			result.WriteByte(text[i])
+		case i == 0 || !covered[i-1]:
+			result.WriteString(MaskedValue)
+		}
+	}
+	return result.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
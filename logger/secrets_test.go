@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newTestLog returns the logger writing to the log directory of a temporary working directory.
+// The log has to be closed by readLog.
+func newTestLog(t *testing.T) *Log {
+	t.Helper()
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workDir) })
+
+	return NewLogger("Test")
+}
+
+// readLog closes the log and returns lines written to its file
+func readLog(t *testing.T, log *Log) []string {
+	t.Helper()
+
+	log.Close()
+	content, err := ioutil.ReadFile(log.GetFileName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\r\n"), "\r\n")
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		text    string
+		want    string
+	}{
+		{"no secrets", nil, "password p@ss", "password p@ss"},
+		{"empty secret is ignored", []string{""}, "password p@ss", "password p@ss"},
+		{"every occurrence", []string{"p@ss"}, "p@ss and p@ss", "*** and ***"},
+		{"secret containing another", []string{"ss", "p@ss"}, "login p@ss", "login ***"},
+		{"overlapping secrets", []string{"abc", "bcd"}, "x abcd y", "x *** y"},
+		{"adjacent secrets", []string{"ab", "cd"}, "abcd", "***"},
+		{"repeated characters", []string{"aa"}, "aaa b", "*** b"},
+		{"duplicate secrets", []string{"p@ss", "p@ss"}, "p@ss", "***"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &secrets{}
+			s.add(tt.secrets)
+			if got := s.mask(tt.text); got != tt.want {
+				t.Errorf("mask(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogMasksShortSecretsOnlyInText(t *testing.T) {
+	log := newTestLog(t)
+	// the secrets are parts of the time and the level of every line
+	log.AddSecret("0", "2", "Info", "Error")
+	log.Info("Token 20 for Info")
+	log.Error(errors.New("login failed"), "Error 2")
+
+	lines := readLog(t, log)
+	prefix := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2}) \[(Info|Error)\]: `)
+	for _, line := range lines {
+		if !prefix.MatchString(line) {
+			t.Errorf("the time or the level of the line is masked: %q", line)
+		}
+	}
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], "]: Token *** for ***") || !strings.HasSuffix(lines[1], "]: *** ***") {
+		t.Errorf("lines = %q, want secrets masked in the text", lines)
+	}
+}
+
+func TestLogMasksSecretsAddedLater(t *testing.T) {
+	log := newTestLog(t)
+	log.Info("before p@ss")
+	log.AddSecret("p@ss")
+	log.Info("after p@ss")
+	if got := log.Mask("body p@ss"); got != "body ***" {
+		t.Errorf("Mask() = %q, want the secret masked", got)
+	}
+
+	lines := readLog(t, log)
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "before p@ss") || !strings.HasSuffix(lines[1], "after ***") {
+		t.Errorf("lines = %q, want only the message written after AddSecret masked", lines)
+	}
+}
@@ -1,44 +1,179 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/doctor"
 	"github.com/sergeyzalunin/go-replication-loader/loader"
 	"github.com/sergeyzalunin/go-replication-loader/logger"
 	"github.com/sergeyzalunin/go-replication-loader/message"
+	"github.com/sergeyzalunin/go-replication-loader/mssql"
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
+	"github.com/sergeyzalunin/go-replication-loader/schedule"
 )
 
+// compileCommand stops services, compiles the solution and starts services without imports
+const compileCommand = "compile"
+
 func main() {
-	var hasreplications bool
 	var args *argsp.ArgumentOptions
 	var log *logger.Log
 
-	defer func() {
-		if hasreplications {
-			sendEmail(args, log, recover())
-		}
-	}()
+	var doctorOptions *doctor.Options
+	if isCommand(doctor.Command) {
+		doctorOptions = doctor.RegisterFlags()
+	}
+	compileOnly := isCommand(compileCommand)
 
-	args = getArguments(log)
+	args, argsErr := getArguments(log)
 
 	log = logger.NewLogger(args.ProjectName)
 	defer log.Close()
+	log.AddSecret(args.Secrets()...)
+	// the logger doesn't exist while arguments are read
+	log.LogIfError(argsErr, "Flags of the command line couldn't be applied over saved arguments")
+
+	ctx, cancel := interruptibleContext(log)
+	defer cancel()
+
+	if doctorOptions != nil {
+		if !diagnose(ctx, args, doctorOptions, log) {
+			cancel()
+			log.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if compileOnly {
+		if err := compile(ctx, args, log); err != nil {
+			cancel()
+			log.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args.Watch {
+		watch(ctx, args, log)
+		return
+	}
+
+	// replications waiting for the next maintenance window aren't a failure
+	if err := install(ctx, args, log); err != nil && !errors.Is(err, schedule.ErrOutsideWindow) {
+		cancel()
+		log.Close()
+		os.Exit(1)
+	}
+}
+
+// isCommand removes the subcommand from the command line if it's passed,
+// so the rest of flags are parsed as usual
+func isCommand(name string) bool {
+	if len(os.Args) < 2 || os.Args[1] != name {
+		return false
+	}
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return true
+}
+
+// diagnose checks the environment and prints the results, it returns false if any check failed
+func diagnose(ctx context.Context, args *argsp.ArgumentOptions, options *doctor.Options, log *logger.Log) bool {
+	report := doctor.Run(ctx, args, options, log)
+
+	var err error
+	if options.JSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	log.LogIfError(err, "Failed to print results of the diagnostics")
+	return report.Passed
+}
 
-	hasreplications, err := doInstallation(args, log)
+func install(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) error {
+	l, err := newLoader(args, log)
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	_, err = l.Load(ctx)
+	return err
+}
+
+// compile recompiles the solution without importing replications
+func compile(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) error {
+	l, err := newLoader(args, log)
+	if err != nil {
+		return err
+	}
+
+	return l.Compile(ctx)
+}
+
+// newLoader builds the loader which reports results by email
+func newLoader(args *argsp.ArgumentOptions, log *logger.Log) (*loader.Loader, error) {
+	notifier := message.New(args, log)
+	l, err := loader.NewLoaderBuilder(args, log).
+		WithNotifier(&notifier).
+		WithPreflightCheck("SMTP server", notifier.CheckConnection).
+		WithDefaults().
+		Build()
+	if err != nil {
+		log.Error(err, "Failed to create the loader")
+	}
+	return l, err
 }
 
-func getArguments(log *logger.Log) *argsp.ArgumentOptions {
+// watch installs replications as soon as they are copied to the replication directory
+// until Ctrl+C or SIGTERM is received
+func watch(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) {
+	repl := &replication.ReplicationLoader{}
+	err := repl.Init(args.DatabaseName, log)
+	if err != nil {
+		log.Error(err, "Failed to start watching the replication directory")
+		return
+	}
+
+	interval := time.Duration(args.WatchInterval) * time.Second
+	settle := time.Duration(args.WatchSettle) * time.Second
+	watcher := replication.NewWatcher(repl, interval, settle, isTransientInstallError, log)
+	watcher.Watch(ctx, func(ctx context.Context) error {
+		err := install(ctx, args, log)
+
+		var outside *schedule.OutsideWindowError
+		switch {
+		case errors.As(err, &outside):
+			return &replication.PostponedError{Until: outside.Next}
+		case errors.Is(err, replication.ErrLocked), errors.Is(err, mssql.ErrAppLocked):
+			// another loader is installing replications, they are checked again later
+			return &replication.PostponedError{}
+		}
+		return err
+	})
+}
+
+// getArguments returns the arguments and the error of applying the command line over saved ones,
+// which is reported after the logger is created
+func getArguments(log *logger.Log) (*argsp.ArgumentOptions, error) {
 	args := &argsp.ArgumentOptions{}
 	args.Init()
 
 	prjname, saveArgs, readSavedArgs := args.ProjectName, args.SaveArgs, args.ReadSavedArgs
-	interactive, skipBackup := args.UseInteractive, args.SkipBackup
+	interactive, skipBackup, dryRun, resume := args.UseInteractive, args.SkipBackup, args.DryRun, args.Resume
+	watch, force := args.Watch, args.Force
 
+	var overrideErr error
 	savedArguments := argsp.ReadArguments(log)
 	if !savedArguments.IsEmpty() {
 		args = savedArguments
@@ -47,16 +182,29 @@ func getArguments(log *logger.Log) *argsp.ArgumentOptions {
 		args.SaveArgs = saveArgs
 		args.ReadSavedArgs = readSavedArgs
 		args.SkipBackup = skipBackup
+		args.DryRun = dryRun
+		args.Resume = resume
+		args.Watch = watch
+		args.Force = force
+		overrideErr = args.Override()
 	}
-	
+
 	args = argsp.StartInteractiveMode(args, log)
 	argsp.SaveArguments(args, log)
 
 	if readSavedArgs {
-		prettyPrint(args)
+		prettyPrint(args.Masked())
 	}
 
-	return args
+	return args, overrideErr
+}
+
+// isTransientInstallError returns true if the installation may succeed being repeated
+// without changing replications. Pre-flight checks fail before anything is changed,
+// e.g. when SQL Server or the service is restarting.
+func isTransientInstallError(err error) bool {
+	var preflightErr *loader.PreflightError
+	return errors.As(err, &preflightErr) || retry.Transient(err)
 }
 
 func prettyPrint(data interface{}) {
@@ -69,15 +217,42 @@ func prettyPrint(data interface{}) {
 	fmt.Printf("%s \n", p)
 }
 
-func doInstallation(args *argsp.ArgumentOptions, log *logger.Log) (bool, error) {
-	l := loader.NewLoader(args, log)
-	return l.Load()
-}
-func sendEmail(args *argsp.ArgumentOptions, log *logger.Log, err interface{}) {
-	e := message.New(args, log)
-	if err == nil {
-		e.Send()
-	} else {
-		e.SendFailed(err)
+// interruptibleContext returns the context cancelled by Ctrl+C or SIGTERM,
+// so the installation stops running processes and restarts services.
+// Signals are handled until the returned function is called,
+// so repeated Ctrl+C doesn't kill the process while services are restarted or the database is restored.
+func interruptibleContext(log *logger.Log) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(stopped)
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				if ctx.Err() != nil {
+					log.Info("The signal ", sig, " is received again, waiting until the installation is cancelled")
+					continue
+				}
+				log.Info("The signal ", sig, " is received, the installation is being cancelled")
+				cancel()
+			case <-finished:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			close(finished)
+			// the log isn't written after it's closed by the caller
+			<-stopped
+		})
 	}
 }
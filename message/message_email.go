@@ -1,10 +1,14 @@
 package message
 
 import (
+	"context"
 	"crypto/tls"
+	stderrors "errors"
 	"fmt"
+	"net"
 	"net/smtp"
 	"net/textproto"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -12,15 +16,28 @@ import (
 
 	"github.com/jordan-wright/email"
 	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/loader"
 	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/mssql"
 	rep "github.com/sergeyzalunin/go-replication-loader/replication"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
+	"github.com/sergeyzalunin/go-replication-loader/schedule"
 )
 
+// smtpCheckTimeout limits the pre-flight check of SMTP server
+const smtpCheckTimeout = 10 * time.Second
+
+// ErrSendFailed is returned when the email couldn't be sent
+var ErrSendFailed = stderrors.New("failed to send the email")
+
 // EmailMessage sends email by using inputs via ArgumentOptions
 type EmailMessage struct {
-	log                   *logger.Log
-	args                  *argsp.ArgumentOptions
-	deleteDescriptionFile bool
+	log  *logger.Log
+	args *argsp.ArgumentOptions
+	// Descriptions of imported replications are added to the message of the completed run
+	Descriptions []string
+	// Summary is the parsed output of tools added to the message
+	Summary string
 }
 
 // New is a constructor for EmailMessageType
@@ -33,33 +50,54 @@ func New(args *argsp.ArgumentOptions, logger *logger.Log) EmailMessage {
 }
 
 // Send message via email
-func (em *EmailMessage) Send() {
-	em.deleteDescriptionFile = true
-	em.send(nil)
+func (em *EmailMessage) Send() error {
+	return em.send(nil)
 }
 
-// SendFailed message via email if programm catches exception
-func (em *EmailMessage) SendFailed(err interface{}) {
-	em.deleteDescriptionFile = false
-	em.send(err.(error))
+// Notify sends the result of the run, so EmailMessage can be used as a notifier of the loader.
+// The run stopped at the end of the maintenance window is reported as completed
+// with the rest of replications postponed.
+func (em *EmailMessage) Notify(report loader.RunReport) error {
+	em.Descriptions = report.Descriptions
+	em.Summary = report.Summary()
+
+	var postponed *schedule.OutsideWindowError
+	if stderrors.As(report.Err, &postponed) {
+		return em.send(postponed)
+	}
+	if report.Err == nil {
+		return em.Send()
+	}
+	return em.SendFailed(report.Err)
 }
 
-func (em EmailMessage) send(err error) {
-	if em.hasAnyEmailCommandLineParameters() {
-		var e *email.Email
+// SendFailed message via email if the installation failed
+func (em *EmailMessage) SendFailed(err error) error {
+	return em.send(err)
+}
 
-		if err == nil {
-			e = em.getEmail()
-		} else {
-			e = em.getErrorEmail(err)
-		}
+func (em EmailMessage) send(err error) error {
+	if !em.hasAnyEmailCommandLineParameters() {
+		return nil
+	}
 
-		err = em.sendWithTLS(e)
+	var e *email.Email
+	var postponed *schedule.OutsideWindowError
+	if err == nil || stderrors.As(err, &postponed) {
+		e, err = em.getEmail(postponed)
 		if err != nil {
-			em.log.Fatal(err)
-			panic(err)
+			return fmt.Errorf("%w: %v", ErrSendFailed, err)
 		}
+	} else {
+		e = em.getErrorEmail(err)
 	}
+
+	err = em.sendWithTLS(e)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrSendFailed, err)
+		em.log.Fatal(err)
+	}
+	return err
 }
 
 func (em EmailMessage) hasAnyEmailCommandLineParameters() bool {
@@ -71,6 +109,60 @@ func (em EmailMessage) hasAnyEmailCommandLineParameters() bool {
 	return !result
 }
 
+// CheckConnection checks that SMTP server is reachable if the email is configured
+func (em EmailMessage) CheckConnection(ctx context.Context) error {
+	if !em.hasAnyEmailCommandLineParameters() {
+		return nil
+	}
+
+	addr := fmt.Sprintf("%s:%d", em.args.SMTPServer, em.args.SMTPPort)
+	dialer := net.Dialer{Timeout: smtpCheckTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// IsConfigured returns true if all settings needed to send emails are set
+func (em EmailMessage) IsConfigured() bool {
+	return em.hasAnyEmailCommandLineParameters()
+}
+
+// CheckLogin connects to SMTP server and logs in without sending anything
+func (em EmailMessage) CheckLogin() error {
+	addr := fmt.Sprintf("%s:%d", em.args.SMTPServer, em.args.SMTPPort)
+	dialer := &net.Dialer{Timeout: smtpCheckTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, em.tlsConfig())
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, em.args.SMTPServer)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err = client.Auth(em.auth()); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// SendTest sends the test email to check the settings
+func (em EmailMessage) SendTest() error {
+	e := &email.Email{
+		From:    em.args.From,
+		To:      em.args.ToEmailList,
+		Subject: fmt.Sprintf("Test message of replication loader on %s Base", em.args.ProjectName),
+		Text:    []byte("The email settings of replication loader are correct."),
+		Headers: textproto.MIMEHeader{},
+	}
+	return em.sendWithTLS(e)
+}
+
 func hasAnyEmptyEmail(toEmails []string) bool {
 	if len(toEmails) == 0 {
 		return true
@@ -85,12 +177,14 @@ func hasAnyEmptyEmail(toEmails []string) bool {
 	return false
 }
 
-func (em EmailMessage) getEmail() *email.Email {
+// getEmail returns the email about the completed run,
+// postponed is set if the rest of replications waits for the next maintenance window
+func (em EmailMessage) getEmail(postponed *schedule.OutsideWindowError) (*email.Email, error) {
 	e := email.Email{
 		From:    em.args.From,
 		To:      em.args.ToEmailList,
-		Subject: em.getSubject(),
-		Text:    em.getMessageBody(),
+		Subject: em.getSubject(postponed),
+		Text:    em.getMessageBody(postponed),
 		Headers: textproto.MIMEHeader{},
 	}
 	_, err := e.AttachFile(em.log.GetFileName())
@@ -98,14 +192,14 @@ func (em EmailMessage) getEmail() *email.Email {
 		em.log.Error(errors.New(err), "Couldn't attach log file due to error")
 	}
 
-	return &e
+	return &e, nil
 }
 
 func (em EmailMessage) getErrorEmail(err error) *email.Email {
 	e := email.Email{
 		From:    em.args.From,
 		To:      em.args.ToEmailList,
-		Subject: em.getErrorSubject(),
+		Subject: em.getErrorSubject(err),
 		Text:    em.getErrorMessageBody(err),
 		Headers: textproto.MIMEHeader{},
 	}
@@ -113,41 +207,129 @@ func (em EmailMessage) getErrorEmail(err error) *email.Email {
 	return &e
 }
 
-func (em EmailMessage) getSubject() string {
+func (em EmailMessage) getSubject(postponed *schedule.OutsideWindowError) string {
 	eventTime := time.Now().Format("02.01.2006 15:04:05")
+	if postponed != nil {
+		return fmt.Sprintf("Replication on %s Base Partially Completed at %s, the Rest is Postponed",
+			em.args.ProjectName, eventTime)
+	}
 	return fmt.Sprintf("Replication on %s Base Completed Successfully at %s", em.args.ProjectName, eventTime)
 }
 
-func (em EmailMessage) getErrorSubject() string {
+func (em EmailMessage) getErrorSubject(err error) string {
 	eventTime := time.Now().Format("02.01.2006 15:04:05")
+
+	var rollbackErr *loader.RollbackError
+	if stderrors.As(err, &rollbackErr) && rollbackErr.IsRolledBack() {
+		return fmt.Sprintf("Replication on %s Base Failed and Rolled Back at %s", em.args.ProjectName, eventTime)
+	}
 	return fmt.Sprintf("Replication on %s Base Failed at %s", em.args.ProjectName, eventTime)
 }
 
-func (em EmailMessage) getMessageBody() []byte {
-	loader := rep.DescriptionLoader{}
-	loader.Init(em.args.DatabaseName, em.log)
-	desc := loader.GetDescriptionContent(em.deleteDescriptionFile)
+// getMessageBody combines the body of arguments with descriptions of imported replications,
+// their files are archived with replications by the loader
+func (em EmailMessage) getMessageBody(postponed *schedule.OutsideWindowError) []byte {
+	desc := strings.Join(em.Descriptions, rep.LineBreak)
 	result := fmt.Sprintf("%s\n\n%s", em.args.Body, desc)
-	return []byte(result)
+	if postponed != nil {
+		result += fmt.Sprintf("\n\nThe maintenance window ended, the rest of replications is postponed: %v", postponed)
+	}
+	return []byte(em.log.Mask(result + em.getSummary()))
 }
 
 func (em EmailMessage) getErrorMessageBody(err error) []byte {
-	result := fmt.Sprintf("The replication failed with next exception: %s\n"+
-		"See the attached log file for details.", err.Error())
-	return []byte(result)
+	result := fmt.Sprintf("%s\n\nThe replication failed with next exception: %s\n"+
+		"See the attached log file for details.", describeFailure(err), err.Error())
+	return []byte(em.log.Mask(result + em.getSummary()))
+}
+
+func (em EmailMessage) getSummary() string {
+	if em.Summary == "" {
+		return ""
+	}
+	return "\n\nOutput of tools:\n" + em.Summary
 }
 
+// describeFailure explains the reason of the failure in a sentence
+func describeFailure(err error) string {
+	var importErr *loader.ImportError
+	var compilationErr *loader.CompilationError
+	var preflightErr *loader.PreflightError
+	var timeoutErr *loader.TimeoutError
+	var outputErr *loader.OutputError
+
+	switch {
+	case stderrors.Is(err, loader.ErrInterrupted):
+		return "The installation was interrupted."
+	case stderrors.As(err, &preflightErr):
+		return "Pre-flight checks failed, no service was stopped and no replication was installed."
+	case stderrors.As(err, &importErr) && stderrors.As(err, &timeoutErr):
+		return fmt.Sprintf("The replication %s was killed after the timeout of %s.",
+			filepath.Base(importErr.File), timeoutErr.Timeout)
+	case stderrors.As(err, &timeoutErr):
+		return fmt.Sprintf("%s was killed after the timeout of %s.", timeoutErr.Tool, timeoutErr.Timeout)
+	case stderrors.As(err, &importErr) && stderrors.As(err, &outputErr):
+		return fmt.Sprintf("The replication %s failed to import, the output of %s reports a failure.",
+			filepath.Base(importErr.File), outputErr.Tool)
+	case stderrors.As(err, &outputErr):
+		return fmt.Sprintf("The output of %s reports a failure.", outputErr.Tool)
+	case stderrors.As(err, &importErr):
+		return fmt.Sprintf("The replication %s failed to import with exit code %d.",
+			filepath.Base(importErr.File), importErr.ExitCode)
+	case stderrors.As(err, &compilationErr) && len(compilationErr.Messages) > 0:
+		first := compilationErr.Messages[0]
+		return fmt.Sprintf("The compilation failed with %d error(s), the first one is in %s(%d): %s.",
+			len(compilationErr.Messages), first.File, first.Line, first.Message)
+	case stderrors.As(err, &compilationErr):
+		return fmt.Sprintf("The compilation failed with exit code %d.", compilationErr.ExitCode)
+	case stderrors.Is(err, mssql.ErrBackupFailed):
+		return "The backup of database failed, no replication was installed."
+	case stderrors.Is(err, loader.ErrServiceStop):
+		return "The service couldn't be stopped, no replication was installed."
+	case stderrors.Is(err, loader.ErrServiceStart):
+		return "The service couldn't be started."
+	case stderrors.Is(err, rep.ErrInvalidPackage):
+		return "The replication package failed verification, no replication was installed."
+	case stderrors.Is(err, rep.ErrInvalidOrder):
+		return "The order of replications is ambiguous, no replication was installed."
+	case stderrors.Is(err, rep.ErrReadFiles):
+		return "The replication files couldn't be read."
+	default:
+		return "The installation failed."
+	}
+}
+
+// sendWithTLS repeats sending if the connection fails or the server rejects the email temporarily
 func (em *EmailMessage) sendWithTLS(e *email.Email) error {
 	addr := fmt.Sprintf("%s:%d", em.args.SMTPServer, em.args.SMTPPort)
-	auth := smtp.PlainAuth(
+	policy := retry.NewPolicy("Sending of email via "+addr, isTransient)
+	return policy.Do(context.Background(), em.log, func(ctx context.Context) error {
+		return e.SendWithTLS(addr, em.auth(), em.tlsConfig())
+	})
+}
+
+// isTransient returns true for network errors and replies of SMTP server with 4xx codes,
+// which mean the server can't accept the email right now
+func isTransient(err error) bool {
+	var smtpErr *textproto.Error
+	if stderrors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+	return retry.Transient(err)
+}
+
+func (em EmailMessage) auth() smtp.Auth {
+	return smtp.PlainAuth(
 		"",
 		em.args.SMTPLogin,
 		em.args.SMTPPassword,
 		em.args.SMTPServer,
 	)
+}
 
-	return e.SendWithTLS(addr, auth, &tls.Config{
+func (em EmailMessage) tlsConfig() *tls.Config {
+	return &tls.Config{
 		InsecureSkipVerify: true,
 		ServerName:         em.args.SMTPServer,
-	})
+	}
 }
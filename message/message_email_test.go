@@ -1,7 +1,90 @@
-package message_test
+package message
 
-/*import . "github.com/sergeyzalunin/go-replication-loader/message"
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
 
-func TestNew()  {
-	e := New()
-}*/
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/loader"
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// newTestMessage returns the message of arguments with passwords,
+// its logger knows the passwords as secrets the way main registers them
+func newTestMessage(t *testing.T) (EmailMessage, *argsp.ArgumentOptions) {
+	t.Helper()
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	args := &argsp.ArgumentOptions{
+		ProjectName:      "Test",
+		DatabaseName:     "Test",
+		Password:         "Adm1n!pass",
+		SMTPPassword:     "smtp-secret",
+		DatabasePassword: "db-secret",
+		Body:             "Replications are installed",
+	}
+	log := logger.NewLogger(args.ProjectName)
+	log.AddSecret(args.Secrets()...)
+	// the message makes Close wait until the log file is opened in the temporary directory
+	log.Info("Test ", t.Name(), " started")
+	t.Cleanup(func() {
+		log.Close()
+		os.Chdir(workDir)
+	})
+
+	return New(args, log), args
+}
+
+func assertMasked(t *testing.T, body string, args *argsp.ArgumentOptions) {
+	t.Helper()
+	for _, secret := range args.Secrets() {
+		if strings.Contains(body, secret) {
+			t.Errorf("the body contains the password %q:\n%s", secret, body)
+		}
+	}
+	if !strings.Contains(body, logger.MaskedValue) {
+		t.Errorf("the body has no masked passwords:\n%s", body)
+	}
+}
+
+func TestErrorBodyMasksPasswordsOfCommandLine(t *testing.T) {
+	em, args := newTestMessage(t)
+
+	// the tool error quotes its command line with the password as it was passed to the tool
+	commandLine := loader.NewCommandLine(true).
+		Option("user", "admin").
+		SecretOption("password", args.Password).
+		Option("file", "0001_first.rep")
+	toolErr := errors.New("Akforta.eLeed.AdminToolsConsole.exe " + commandLine.String() + " exited with code 3")
+	err := &loader.ImportError{File: "0001_first.rep", ExitCode: 3,
+		Err: errors.New(toolErr.Error() + ", SMTP login failed for smtp-secret, db password db-secret")}
+
+	em.Summary = "Import of 0001_first.rep failed, password " + args.Password
+	body := string(em.getErrorMessageBody(err))
+
+	assertMasked(t, body, args)
+	if !strings.Contains(body, "The replication 0001_first.rep failed to import") {
+		t.Errorf("the body doesn't describe the failure:\n%s", body)
+	}
+}
+
+func TestMessageBodyMasksPasswords(t *testing.T) {
+	em, args := newTestMessage(t)
+	em.Descriptions = []string{"Task 1: the password of admin is reset to " + args.Password}
+
+	body := string(em.getMessageBody(nil))
+
+	assertMasked(t, body, args)
+	if !strings.HasPrefix(body, args.Body) || !strings.Contains(body, "Task 1") {
+		t.Errorf("the body doesn't contain the body of arguments and descriptions:\n%s", body)
+	}
+}
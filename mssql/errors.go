@@ -0,0 +1,10 @@
+package mssql
+
+import "errors"
+
+var (
+	// ErrBackupFailed is returned when the backup of database wasn't made
+	ErrBackupFailed = errors.New("backup of database failed")
+	// ErrRestoreFailed is returned when the database wasn't restored from the backup
+	ErrRestoreFailed = errors.New("restore of database failed")
+)
@@ -1,22 +1,62 @@
 package mssql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
-
-	"github.com/go-errors/errors"
+	"strings"
 
 	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/sergeyzalunin/go-replication-loader/argsp"
 	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
 )
 
-// DoBackup create an backup of target database provided via ArgumentOptions
-func DoBackup(args *argsp.ArgumentOptions, log *logger.Log) {
+// BackupProvider makes a backup of the target database
+// and restores the database from it.
+// DatabaseSize checks that the server is reachable before anything is stopped
+// and returns the size of database the backup takes.
+type BackupProvider interface {
+	Backup(ctx context.Context) error
+	Restore(ctx context.Context) error
+	DatabaseSize(ctx context.Context) (int64, error)
+}
+
+type sqlBackupProvider struct {
+	args *argsp.ArgumentOptions
+	log  *logger.Log
+}
+
+// NewBackupProvider is a constructor of BackupProvider working with MSSQL
+func NewBackupProvider(args *argsp.ArgumentOptions, log *logger.Log) BackupProvider {
+	return sqlBackupProvider{args, log}
+}
+
+func (p sqlBackupProvider) Backup(ctx context.Context) error {
+	return DoBackup(ctx, p.args, p.log)
+}
+
+func (p sqlBackupProvider) Restore(ctx context.Context) error {
+	return DoRestore(ctx, p.args, p.log)
+}
+
+func (p sqlBackupProvider) DatabaseSize(ctx context.Context) (int64, error) {
+	return DatabaseSize(ctx, p.args)
+}
+
+// DoBackup create an backup of target database provided via ArgumentOptions.
+// The backup query is aborted if the context is cancelled.
+func DoBackup(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) error {
 	if args.SkipBackup {
 		log.Info("Backup of database skipped due to skipbackup flag")
-		return
+		return nil
+	}
+
+	if args.DryRun {
+		getBackupCommand(args, log)
+		log.Info("[dry run] Backup of database ", args.DatabaseName, " would be made by the query above")
+		return nil
 	}
 
 	backupState := "with error"
@@ -24,18 +64,20 @@ func DoBackup(args *argsp.ArgumentOptions, log *logger.Log) {
 	defer func() {
 		log.Info("Backup of database ", args.DatabaseName, " finished ", backupState)
 	}()
-// Unable to get instances from Sql Server Browser on host localhost: read udp [::1]:54097->[::1]:1434: i/o timeout
-	err := doBackup(args, log)
+
+	err := doBackup(ctx, args, log)
 	if err == nil {
 		backupState = "successfully"
-	} else {
-		msg := "You are not allowed to continue installation a replication without successful backup \r\n%s"
-		log.Fatal(errors.Errorf(msg, err))
-		panic(msg)
+		return nil
 	}
+
+	msg := "%w. You are not allowed to continue installation a replication without successful backup \r\n%v"
+	err = fmt.Errorf(msg, ErrBackupFailed, err)
+	log.Fatal(err)
+	return err
 }
 
-func doBackup(args *argsp.ArgumentOptions, log *logger.Log) error {
+func doBackup(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) error {
 	connString, err := getConnection(args)
 	if err != nil {
 		return err
@@ -51,10 +93,30 @@ func doBackup(args *argsp.ArgumentOptions, log *logger.Log) error {
 	db := sql.OpenDB(connector)
 	defer db.Close()
 
-	_, err = db.Exec(backupCommand)
+	// the connection is set up before the backup starts,
+	// so only the connection is repeated and the backup query runs once
+	policy := retry.NewPolicy("Connection to SQL Server", isTransient)
+	err = policy.Do(ctx, log, db.PingContext)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, backupCommand)
 	return err
 }
 
+// isTransient returns true for network errors and timeouts of SQL Server Browser, e.g.
+// Unable to get instances from Sql Server Browser on host localhost: read udp [::1]:54097->[::1]:1434: i/o timeout
+// The driver doesn't wrap the cause of the browser error, so it's recognized by the text.
+func isTransient(err error) bool {
+	if retry.Transient(err) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Unable to get instances from Sql Server Browser") ||
+		strings.Contains(msg, "i/o timeout")
+}
+
 func getConnection(args *argsp.ArgumentOptions) (string, error) {
 	if args.DatabaseName == "" {
 		err := "The database name doesn't set in command line. Use -dbname or -help command"
@@ -64,8 +126,24 @@ func getConnection(args *argsp.ArgumentOptions) (string, error) {
 	return connectionString, nil
 }
 
+// BackupFileName returns the path to the backup made before the installation
+func BackupFileName(args *argsp.ArgumentOptions) string {
+	return filepath.Join(args.BackupPath, args.DatabaseName+"_ReplicLoaderAutobackup.bak")
+}
+
+// getMasterConnection returns the connection string to master database of the same server
+func getMasterConnection(args *argsp.ArgumentOptions) (string, error) {
+	if _, err := getConnection(args); err != nil {
+		return "", err
+	}
+
+	masterArgs := *args
+	masterArgs.DatabaseName = masterDatabase
+	return NewConnectionString(&masterArgs), nil
+}
+
 func getBackupCommand(args *argsp.ArgumentOptions, log *logger.Log) string {
-	filename := filepath.Join(args.BackupPath, args.DatabaseName+"_ReplicLoaderAutobackup.bak")
+	filename := BackupFileName(args)
 	log.Info("Backup will be saved at the path ", filename)
 
 	var compressionString string
@@ -0,0 +1,92 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+)
+
+const createHistoryTableQuery = `IF OBJECT_ID(N'dbo.ReplicLoaderHistory', N'U') IS NULL
+CREATE TABLE dbo.ReplicLoaderHistory (
+	Hash char(64) NOT NULL,
+	FileName nvarchar(260) NOT NULL,
+	DatabaseName sysname NOT NULL,
+	RunID varchar(32) NOT NULL,
+	AppliedAt datetime2 NOT NULL,
+	CONSTRAINT PK_ReplicLoaderHistory PRIMARY KEY (Hash, RunID)
+);`
+
+const findHistoryQuery = `SELECT TOP 1 Hash, FileName, DatabaseName, RunID, AppliedAt
+FROM dbo.ReplicLoaderHistory WHERE Hash = @hash ORDER BY AppliedAt`
+
+const addHistoryQuery = `INSERT INTO dbo.ReplicLoaderHistory (Hash, FileName, DatabaseName, RunID, AppliedAt)
+VALUES (@hash, @file, @database, @runID, @time)`
+
+const forgetHistoryQuery = `DELETE FROM dbo.ReplicLoaderHistory WHERE RunID = @runID`
+
+// HistoryTable keeps the history of applied replications in the target database,
+// so it's restored together with the database
+type HistoryTable struct {
+	db *sql.DB
+}
+
+// OpenHistoryTable connects to the target database and creates the history table if it doesn't exist
+func OpenHistoryTable(ctx context.Context, args *argsp.ArgumentOptions) (*HistoryTable, error) {
+	connString, err := getConnection(args)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := mssql.NewConnector(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &HistoryTable{sql.OpenDB(connector)}
+	// idle connections would prevent RESTORE of the database on rollback
+	table.db.SetMaxIdleConns(0)
+	if _, err = table.db.ExecContext(ctx, createHistoryTableQuery); err != nil {
+		table.Close()
+		return nil, err
+	}
+	return table, nil
+}
+
+// Find returns the first application of the replication with the hash
+func (t *HistoryTable) Find(hash string) (*replication.HistoryRecord, error) {
+	record := &replication.HistoryRecord{}
+	err := t.db.QueryRow(findHistoryQuery, sql.Named("hash", hash)).
+		Scan(&record.Hash, &record.File, &record.Database, &record.RunID, &record.Time)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Add inserts the applied replication
+func (t *HistoryTable) Add(record replication.HistoryRecord) error {
+	_, err := t.db.Exec(addHistoryQuery,
+		sql.Named("hash", record.Hash),
+		sql.Named("file", record.File),
+		sql.Named("database", record.Database),
+		sql.Named("runID", record.RunID),
+		sql.Named("time", record.Time))
+	return err
+}
+
+// Forget deletes the replications applied by the run
+func (t *HistoryTable) Forget(runID string) error {
+	_, err := t.db.Exec(forgetHistoryQuery, sql.Named("runID", runID))
+	return err
+}
+
+// Close closes the connection to the database
+func (t *HistoryTable) Close() error {
+	return t.db.Close()
+}
@@ -0,0 +1,81 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// ErrAppLocked is returned when another loader holds the application lock of the database
+var ErrAppLocked = errors.New("the database is locked by another loader")
+
+const getAppLockQuery = `DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = @resource, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+SELECT @result;`
+
+const releaseAppLockQuery = `EXEC sp_releaseapplock @Resource = @resource, @LockOwner = 'Session';`
+
+// AppLock is the exclusive application lock of SQL Server.
+// It serializes loaders of different hosts working with the same database.
+type AppLock struct {
+	db       *sql.DB
+	conn     *sql.Conn
+	resource string
+}
+
+// AcquireAppLock takes the application lock named after the target database.
+// The lock lives in master, because its session would be killed
+// by RESTORE of the target database on rollback.
+func AcquireAppLock(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) (*AppLock, error) {
+	connString, err := getMasterConnection(args)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := mssql.NewConnector(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &AppLock{
+		db:       sql.OpenDB(connector),
+		resource: "ReplicLoader_" + args.DatabaseName,
+	}
+
+	// the lock is owned by the session, so it must be held by a single connection
+	lock.conn, err = lock.db.Conn(ctx)
+	if err != nil {
+		lock.db.Close()
+		return nil, err
+	}
+
+	var result int
+	err = lock.conn.QueryRowContext(ctx, getAppLockQuery, sql.Named("resource", lock.resource)).Scan(&result)
+	if err == nil && result < 0 {
+		err = fmt.Errorf("%w, sp_getapplock %s returned %d", ErrAppLocked, lock.resource, result)
+	}
+	if err != nil {
+		lock.close()
+		return nil, err
+	}
+
+	log.Info("The application lock ", lock.resource, " is acquired")
+	return lock, nil
+}
+
+// Release frees the application lock
+func (lock *AppLock) Release() error {
+	_, err := lock.conn.ExecContext(context.Background(), releaseAppLockQuery, sql.Named("resource", lock.resource))
+	lock.close()
+	return err
+}
+
+func (lock *AppLock) close() {
+	lock.conn.Close()
+	lock.db.Close()
+}
@@ -0,0 +1,37 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+)
+
+const backupPermissionQuery = `SELECT HAS_PERMS_BY_NAME(DB_NAME(), 'DATABASE', 'BACKUP DATABASE')`
+
+// CheckBackupPermission checks that the login is allowed to backup the target database
+func CheckBackupPermission(ctx context.Context, args *argsp.ArgumentOptions) error {
+	connString, err := getConnection(args)
+	if err != nil {
+		return err
+	}
+
+	connector, err := mssql.NewConnector(connString)
+	if err != nil {
+		return err
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var allowed sql.NullInt64
+	if err = db.QueryRowContext(ctx, backupPermissionQuery).Scan(&allowed); err != nil {
+		return err
+	}
+	if allowed.Int64 != 1 {
+		return fmt.Errorf("the login has no BACKUP DATABASE permission on %s", args.DatabaseName)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// masterDatabase is used to connect while the target database is restored,
+// because RESTORE can't replace the database used by the connection itself
+const masterDatabase = "master"
+
+// DoRestore replaces the target database with the backup
+// made by DoBackup before the installation
+func DoRestore(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) error {
+	restoreState := "with error"
+	log.Info("Restore of database ", args.DatabaseName, " started")
+	defer func() {
+		log.Info("Restore of database ", args.DatabaseName, " finished ", restoreState)
+	}()
+
+	err := doRestore(ctx, args, log)
+	if err != nil {
+		err = fmt.Errorf("%w %s from backup %s\r\n%v",
+			ErrRestoreFailed, args.DatabaseName, BackupFileName(args), err)
+		log.Fatal(err)
+		return err
+	}
+
+	restoreState = "successfully"
+	return nil
+}
+
+// doRestore runs SINGLE_USER, RESTORE and MULTI_USER in one session of the pool,
+// otherwise another connection of the pool could take the only session allowed in single user mode,
+// or MULTI_USER could run in a session which can't access the database
+func doRestore(ctx context.Context, args *argsp.ArgumentOptions, log *logger.Log) (err error) {
+	connString, err := getMasterConnection(args)
+	if err != nil {
+		return err
+	}
+
+	connector, err := mssql.NewConnector(connString)
+	if err != nil {
+		return err
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s SET SINGLE_USER WITH ROLLBACK IMMEDIATE", args.DatabaseName))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the database is returned to multi user mode even if the restore was cancelled
+		_, multiUserErr := conn.ExecContext(context.Background(),
+			fmt.Sprintf("ALTER DATABASE %s SET MULTI_USER", args.DatabaseName))
+		if multiUserErr == nil {
+			return
+		}
+		multiUserErr = fmt.Errorf("database %s is left in single user mode: %w", args.DatabaseName, multiUserErr)
+		log.Error(multiUserErr, "Failed to return database ", args.DatabaseName, " to multi user mode")
+		if err == nil {
+			err = multiUserErr
+		} else {
+			err = fmt.Errorf("%w\r\n%v", err, multiUserErr)
+		}
+	}()
+
+	restoreCommand := getRestoreCommand(args, log)
+	_, err = conn.ExecContext(ctx, restoreCommand)
+	return err
+}
+
+func getRestoreCommand(args *argsp.ArgumentOptions, log *logger.Log) string {
+	filename := BackupFileName(args)
+	result := fmt.Sprintf("RESTORE DATABASE %s FROM DISK = '%s' WITH REPLACE, STATS = 10", args.DatabaseName, filename)
+	log.Info("Restore sql query: ", result)
+	return result
+}
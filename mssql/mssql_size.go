@@ -0,0 +1,34 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/sergeyzalunin/go-replication-loader/argsp"
+)
+
+// pages of data files are 8 KB
+const databaseSizeQuery = `SELECT SUM(CAST(FILEPROPERTY(name, 'SpaceUsed') AS bigint)) * 8192
+FROM sys.database_files WHERE type = 0`
+
+// DatabaseSize connects to the target database and returns the size of its data in bytes.
+// The backup of database takes about the same space without compression.
+func DatabaseSize(ctx context.Context, args *argsp.ArgumentOptions) (int64, error) {
+	connString, err := getConnection(args)
+	if err != nil {
+		return 0, err
+	}
+
+	connector, err := mssql.NewConnector(connString)
+	if err != nil {
+		return 0, err
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var size sql.NullInt64
+	err = db.QueryRowContext(ctx, databaseSizeQuery).Scan(&size)
+	return size.Int64, err
+}
@@ -0,0 +1,10 @@
+package replication
+
+import "errors"
+
+var (
+	// ErrReadFiles is returned when replication or description files can't be read
+	ErrReadFiles = errors.New("failed to read files from the replication directory")
+	// ErrRemoveFiles is returned when description files can't be removed after reading
+	ErrRemoveFiles = errors.New("failed to remove files from the replication directory")
+)
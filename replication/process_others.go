@@ -0,0 +1,95 @@
+// +build !windows
+
+package replication
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks is the number of ticks per second in /proc, USER_HZ is 100 on all supported platforms
+const clockTicks = 100
+
+// processStarted returns the start time of the process with pid or errNoProcess if it isn't running.
+// The start time is read from /proc, zero time is returned where /proc isn't mounted.
+func processStarted(pid int) (time.Time, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	switch {
+	case os.IsNotExist(err) && procMounted():
+		return time.Time{}, errNoProcess
+	case os.IsNotExist(err):
+		return time.Time{}, signalProcess(pid)
+	case err != nil:
+		return time.Time{}, err
+	}
+	return parseProcessStart(content)
+}
+
+func procMounted() bool {
+	_, err := os.Stat("/proc/self/stat")
+	return err == nil
+}
+
+// signalProcess checks that the process exists by the signal 0
+func signalProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	err = process.Signal(syscall.Signal(0))
+	switch err {
+	case nil, syscall.EPERM:
+		return nil
+	default:
+		return errNoProcess
+	}
+}
+
+// parseProcessStart returns the start time from the content of /proc/<pid>/stat.
+// The command name may contain spaces, so the fields are counted after its closing bracket.
+func parseProcessStart(content []byte) (time.Time, error) {
+	fields := strings.Fields(string(content[bytes.LastIndexByte(content, ')')+1:]))
+	// starttime is the 22nd field, the fields after the command name start from the 3rd
+	const startField = 22 - 3
+	if len(fields) <= startField {
+		return time.Time{}, fmt.Errorf("unexpected process stat %q", content)
+	}
+
+	ticks, err := strconv.ParseInt(fields[startField], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return boot.Add(time.Duration(ticks) * time.Second / clockTicks), nil
+}
+
+// bootTime reads the boot time of the system from /proc/stat
+func bootTime() (time.Time, error) {
+	content, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if !strings.HasPrefix(line, "btime ") {
+			continue
+		}
+		seconds, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "btime ")), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("boot time isn't found in /proc/stat")
+}
@@ -0,0 +1,40 @@
+package replication
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	processQueryLimitedInformation = 0x1000
+	errorInvalidParameter          = syscall.Errno(87)
+	stillActive                    = 259
+)
+
+// processStarted returns the start time of the process with pid or errNoProcess if it isn't running.
+// OpenProcess fails with ERROR_INVALID_PARAMETER if there is no such process.
+func processStarted(pid int) (time.Time, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err == errorInvalidParameter {
+		return time.Time{}, errNoProcess
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer syscall.CloseHandle(handle)
+
+	// the exited process is kept while its handles are open
+	var exitCode uint32
+	if err = syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return time.Time{}, err
+	}
+	if exitCode != stillActive {
+		return time.Time{}, errNoProcess
+	}
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err = syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, creation.Nanoseconds()), nil
+}
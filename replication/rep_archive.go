@@ -0,0 +1,212 @@
+package replication
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// ArchiveMode defines what happens with processed replication files
+type ArchiveMode string
+
+const (
+	// ArchiveDelete removes processed files
+	ArchiveDelete ArchiveMode = "delete"
+	// ArchiveMove moves processed files to the archive directory
+	ArchiveMove ArchiveMode = "move"
+	// ArchiveZip compresses processed files into the archive directory
+	ArchiveZip ArchiveMode = "zip"
+)
+
+const (
+	archiveDirectory = "archive"
+	failedDirectory  = "failed"
+)
+
+// Archive keeps processed replication files in archive/<run-id> directory
+// and files failed to import in failed/<run-id> directory of the replication directory
+type Archive struct {
+	log       *logger.Log
+	Mode      ArchiveMode
+	directory string
+	runID     string
+	// Keep is the number of runs kept in the archive, 0 means all
+	Keep int
+	// MaxAge is the age after which runs are removed from the archive, 0 means never
+	MaxAge time.Duration
+}
+
+// NewArchive is a constructor for Archive
+func NewArchive(replicationDirectory, runID, mode string, keep, days int, log *logger.Log) (*Archive, error) {
+	archiveMode := ArchiveMode(strings.ToLower(strings.TrimSpace(mode)))
+	switch archiveMode {
+	case "":
+		archiveMode = ArchiveDelete
+	case ArchiveDelete, ArchiveMove, ArchiveZip:
+	default:
+		return nil, fmt.Errorf("unknown archive mode %q, expected %s, %s or %s",
+			mode, ArchiveDelete, ArchiveMove, ArchiveZip)
+	}
+
+	return &Archive{
+		log:       log,
+		Mode:      archiveMode,
+		directory: replicationDirectory,
+		runID:     runID,
+		Keep:      keep,
+		MaxAge:    time.Duration(days) * 24 * time.Hour,
+	}, nil
+}
+
+// Store removes or archives processed files depending on the mode
+func (a *Archive) Store(files ...string) error {
+	for _, file := range files {
+		if err := a.store(file, archiveDirectory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreFailed moves the replication failed to import and its description to the failed directory.
+// Nothing is done in delete mode, so the replication stays in place to be installed again.
+func (a *Archive) StoreFailed(rep string) error {
+	if a.Mode == ArchiveDelete {
+		return nil
+	}
+
+	for _, file := range []string{rep, DescriptionOf(rep)} {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		if err := a.store(file, failedDirectory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DescriptionOf returns the path to the description of the replication with the same name
+func DescriptionOf(rep string) string {
+	return strings.TrimSuffix(rep, filepath.Ext(rep)) + ".desc"
+}
+
+func (a *Archive) store(file, kind string) error {
+	if a.Mode == ArchiveDelete {
+		err := os.Remove(file)
+		if err == nil {
+			a.log.Info("The file ", file, " was deleted from folder")
+		}
+		return err
+	}
+
+	dir := filepath.Join(a.directory, kind, a.runID)
+	if err := createDirectory(dir); err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, filepath.Base(file))
+	if a.Mode == ArchiveZip {
+		target += ".zip"
+		if err := compress(file, target); err != nil {
+			return err
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	} else if err := os.Rename(file, target); err != nil {
+		return err
+	}
+
+	a.log.Info("The file ", file, " was archived to ", target)
+	return nil
+}
+
+func compress(file, target string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(dst)
+	err = writeZipEntry(archive, src, filepath.Base(file))
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+	}
+	return err
+}
+
+func writeZipEntry(archive *zip.Writer, src io.Reader, name string) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, src)
+	return err
+}
+
+// Prune removes runs from the archive and failed directories
+// exceeding the number of kept runs or older than the max age
+func (a *Archive) Prune() error {
+	for _, kind := range []string{archiveDirectory, failedDirectory} {
+		if err := a.prune(filepath.Join(a.directory, kind)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) prune(dir string) error {
+	runs, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// run ids are timestamps, so the newest runs are at the end
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Name() < runs[j].Name()
+	})
+
+	for i, run := range runs {
+		expired := a.MaxAge > 0 && time.Since(run.ModTime()) > a.MaxAge
+		exceeded := a.Keep > 0 && i < len(runs)-a.Keep
+		if !expired && !exceeded {
+			continue
+		}
+
+		path := filepath.Join(dir, run.Name())
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		a.log.Info("The archived run ", path, " was removed")
+	}
+
+	return nil
+}
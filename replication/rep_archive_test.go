@@ -0,0 +1,245 @@
+package replication
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// archiveFixture creates replication files in a temporary directory
+func archiveFixture(t *testing.T, names ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// dirNames returns sorted names of the directory entries, nil if it doesn't exist
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, entry := range entries {
+		result = append(result, entry.Name())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestNewArchiveMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    ArchiveMode
+		wantErr bool
+	}{
+		{"", ArchiveDelete, false},
+		{"delete", ArchiveDelete, false},
+		{" Move ", ArchiveMove, false},
+		{"ZIP", ArchiveZip, false},
+		{"copy", "", true},
+	}
+
+	for _, tt := range tests {
+		archive, err := NewArchive(t.TempDir(), "run", tt.mode, 0, 0, nil)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewArchive(%q) error = nil, want unknown mode", tt.mode)
+			}
+			continue
+		}
+		if err != nil || archive.Mode != tt.want {
+			t.Errorf("NewArchive(%q) = %v, %v, want %s", tt.mode, archive, err, tt.want)
+		}
+	}
+}
+
+func TestArchiveStore(t *testing.T) {
+	tests := []struct {
+		mode     ArchiveMode
+		archived []string
+	}{
+		{ArchiveDelete, nil},
+		{ArchiveMove, []string{"0001_a.desc", "0001_a.rep"}},
+		{ArchiveZip, []string{"0001_a.desc.zip", "0001_a.rep.zip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			dir := archiveFixture(t, "0001_a.rep", "0001_a.desc", "0002_b.rep")
+			archive, err := NewArchive(dir, "run1", string(tt.mode), 0, 0, newTestLog(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = archive.Store(filepath.Join(dir, "0001_a.rep"), filepath.Join(dir, "0001_a.desc")); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"0002_b.rep"}
+			if tt.archived != nil {
+				want = append(want, "archive")
+			}
+			if got := dirNames(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("replication directory = %v, want %v", got, want)
+			}
+			if got := dirNames(t, filepath.Join(dir, "archive", "run1")); !reflect.DeepEqual(got, tt.archived) {
+				t.Errorf("archive = %v, want %v", got, tt.archived)
+			}
+		})
+	}
+}
+
+func TestArchiveZipKeepsContent(t *testing.T) {
+	dir := archiveFixture(t, "0001_a.rep")
+	archive, err := NewArchive(dir, "run1", "zip", 0, 0, newTestLog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = archive.Store(filepath.Join(dir, "0001_a.rep")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.OpenReader(filepath.Join(dir, "archive", "run1", "0001_a.rep.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if len(reader.File) != 1 || reader.File[0].Name != "0001_a.rep" {
+		t.Fatalf("zip entries = %v, want 0001_a.rep", reader.File)
+	}
+	entry, err := reader.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	content, err := ioutil.ReadAll(entry)
+	if err != nil || string(content) != "0001_a.rep" {
+		t.Errorf("zip content = %q, %v, want the replication", content, err)
+	}
+}
+
+func TestArchiveStoreFailed(t *testing.T) {
+	tests := []struct {
+		mode   ArchiveMode
+		left   []string
+		failed []string
+	}{
+		// the failed replication stays in place to be installed again
+		{ArchiveDelete, []string{"0001_a.desc", "0001_a.rep", "0002_b.rep"}, nil},
+		{ArchiveMove, []string{"failed"}, []string{"0001_a.desc", "0001_a.rep", "0002_b.rep"}},
+		{ArchiveZip, []string{"failed"}, []string{"0001_a.desc.zip", "0001_a.rep.zip", "0002_b.rep.zip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			dir := archiveFixture(t, "0001_a.rep", "0001_a.desc", "0002_b.rep")
+			archive, err := NewArchive(dir, "run1", string(tt.mode), 0, 0, newTestLog(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = archive.StoreFailed(filepath.Join(dir, "0001_a.rep")); err != nil {
+				t.Fatal(err)
+			}
+			// the replication without description
+			if err = archive.StoreFailed(filepath.Join(dir, "0002_b.rep")); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := dirNames(t, dir); !reflect.DeepEqual(got, tt.left) {
+				t.Errorf("replication directory = %v, want %v", got, tt.left)
+			}
+			if got := dirNames(t, filepath.Join(dir, "failed", "run1")); !reflect.DeepEqual(got, tt.failed) {
+				t.Errorf("failed = %v, want %v", got, tt.failed)
+			}
+		})
+	}
+}
+
+// archivedRuns creates runs in the archive and failed directories modified days ago
+func archivedRuns(t *testing.T, dir string, days map[string]int) {
+	t.Helper()
+
+	for _, kind := range []string{archiveDirectory, failedDirectory} {
+		for run, age := range days {
+			path := filepath.Join(dir, kind, run)
+			if err := os.MkdirAll(path, 0777); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-time.Duration(age) * 24 * time.Hour)
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestArchivePrune(t *testing.T) {
+	runs := map[string]int{
+		"20240601T020000": 14,
+		"20240608T020000": 7,
+		"20240614T020000": 1,
+		"20240615T020000": 0,
+	}
+
+	tests := []struct {
+		name string
+		keep int
+		days int
+		want []string
+	}{
+		{"keeps all", 0, 0, []string{"20240601T020000", "20240608T020000", "20240614T020000", "20240615T020000"}},
+		{"by count", 2, 0, []string{"20240614T020000", "20240615T020000"}},
+		{"by age", 0, 5, []string{"20240614T020000", "20240615T020000"}},
+		{"by count and age", 1, 10, []string{"20240615T020000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivedRuns(t, dir, runs)
+			archive, err := NewArchive(dir, "run", "move", tt.keep, tt.days, newTestLog(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = archive.Prune(); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, kind := range []string{archiveDirectory, failedDirectory} {
+				if got := dirNames(t, filepath.Join(dir, kind)); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s = %v, want %v", kind, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestArchivePruneWithoutArchive(t *testing.T) {
+	archive, err := NewArchive(t.TempDir(), "run", "move", 1, 1, newTestLog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = archive.Prune(); err != nil {
+		t.Errorf("Prune() of the empty directory error = %v", err)
+	}
+}
@@ -1,9 +1,8 @@
 package replication
 
 import (
+	"fmt"
 	"io/ioutil"
-	"log"
-	"os"
 	"strings"
 )
 
@@ -16,27 +15,30 @@ type DescriptionLoader struct {
 	FileLoader
 }
 
-// GetDescriptionContent looks for files with *.desc pattern and combines it in a string
-func (loader *DescriptionLoader) GetDescriptionContent(removeAfterRead bool) string {
+// GetDescriptionContent looks for files with *.desc pattern and combines it in a string.
+// Read files are removed or archived if the archive is passed.
+func (loader *DescriptionLoader) GetDescriptionContent(archive *Archive) (string, error) {
 	var result []string
 
-	files := loader.GetFiles("*.desc")
+	files, err := loader.GetFiles("*.desc")
+	if err != nil {
+		return "", err
+	}
+
 	for _, file := range files {
 		dat, err := ioutil.ReadFile(file)
-
 		if err != nil {
-			log.Fatalf("%v couln't read due to error %v", file, err)
-		} else {
-			result = append(result, string(dat))
+			return "", fmt.Errorf("%w, %s couldn't be read: %v", ErrReadFiles, file, err)
 		}
+		result = append(result, string(dat))
 
-		if removeAfterRead {
-			err = os.Remove(file)
+		if archive != nil {
+			err = archive.Store(file)
 			if err != nil {
-				log.Fatalf("%v couln't be removed due to error %v", file, err)
+				return "", fmt.Errorf("%w, %s couldn't be removed: %v", ErrRemoveFiles, file, err)
 			}
 		}
 	}
 
-	return strings.Join(result, LineBreak)
+	return strings.Join(result, LineBreak), nil
 }
@@ -28,39 +28,35 @@ func (file *FileLoader) Init(dbName string, log *logger.Log) error {
 	return setReplicationDirectory(file, dbName)
 }
 
+// Directory returns the replication directory
+func (file *FileLoader) Directory() string {
+	return file.ReplicationDirectory
+}
+
 // GetFiles gets files from the replication
 // directory by particular pattern: *.rep, *.desc, etc
-func (file *FileLoader) GetFiles(pattern string) []string {
+// in natural order of their names
+func (file *FileLoader) GetFiles(pattern string) ([]string, error) {
 	pattern = filepath.Join(file.ReplicationDirectory, pattern)
 
 	files, err := filepath.Glob(pattern)
 	if err != nil {
-		err := fmt.Errorf("An error occured while getting files from directory %s. %v", 
-			file.ReplicationDirectory, err)
-		file.log.Fatal(err)
-		panic(err)
+		return nil, fmt.Errorf("%w %s: %v", ErrReadFiles, file.ReplicationDirectory, err)
 	}
 
-	sort.Slice(files, func(i, j int) bool {
-		fiBefore := getFileInfo(files[i], file.log)
-		fiAfter := getFileInfo(files[j], file.log)
-		if fiBefore != nil && fiAfter != nil {
-			return fiBefore.ModTime().Before(fiAfter.ModTime())
-		}
-		return false
+	sort.SliceStable(files, func(i, j int) bool {
+		return naturalLess(filepath.Base(files[i]), filepath.Base(files[j]))
 	})
 
-	return files
+	return files, nil
 }
 
-func getFileInfo(file string, log *logger.Log) os.FileInfo {
+func getFileInfo(file string) (os.FileInfo, error) {
 	fi, err := os.Stat(file)
 	if err != nil {
-		err = fmt.Errorf("An error occured while getting file info %s. %v", file, err)
-		log.Fatal(err)
-		panic(err)
+		return nil, fmt.Errorf("%w, getting file info %s: %v", ErrReadFiles, file, err)
 	}
-	return fi
+	return fi, nil
 }
 
 func setReplicationDirectory(file *FileLoader, dbName string) error {
@@ -0,0 +1,142 @@
+package replication
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const historyFileName = "history.jsonl"
+
+// HistoryRecord describes the replication applied to the database
+type HistoryRecord struct {
+	Hash     string
+	File     string
+	Database string
+	RunID    string
+	Time     time.Time
+}
+
+// History stores replications applied to the database keyed by the hash of their content
+type History interface {
+	// Find returns the record of the replication with the hash or nil if it hasn't been applied
+	Find(hash string) (*HistoryRecord, error)
+	// Add stores the applied replication
+	Add(record HistoryRecord) error
+	// Forget removes the replications applied by the run, e.g. after the database is restored
+	Forget(runID string) error
+}
+
+// FileHistory keeps the history in a JSON-lines file of the replication directory
+type FileHistory struct {
+	path     string
+	database string
+}
+
+// NewFileHistory is a constructor for FileHistory
+func NewFileHistory(replicationDirectory, database string) *FileHistory {
+	return &FileHistory{filepath.Join(replicationDirectory, historyFileName), database}
+}
+
+// Find looks for the replication applied to the same database
+func (h *FileHistory) Find(hash string) (*HistoryRecord, error) {
+	records, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		if records[i].Hash == hash && strings.EqualFold(records[i].Database, h.database) {
+			return &records[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Add appends the record to the file
+func (h *FileHistory) Add(record HistoryRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Forget rewrites the file without records of the run
+func (h *FileHistory) Forget(runID string) error {
+	records, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	for _, record := range records {
+		if record.RunID == runID && strings.EqualFold(record.Database, h.database) {
+			continue
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		content = append(content, line...)
+		content = append(content, '\n')
+	}
+
+	return ioutil.WriteFile(h.path, content, 0666)
+}
+
+func (h *FileHistory) read() ([]HistoryRecord, error) {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []HistoryRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record HistoryRecord
+		// a broken line is skipped, the rest of the history is still valid
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// FileHash returns SHA-256 of the file content
+func FileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,147 @@
+package replication_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+)
+
+func TestFileHistory(t *testing.T) {
+	dir := t.TempDir()
+	history := replication.NewFileHistory(dir, "Test")
+
+	record, err := history.Find("aaa")
+	if err != nil || record != nil {
+		t.Fatalf("Find() in the missing file = %+v, %v, want nil, nil", record, err)
+	}
+
+	started := time.Date(2024, time.June, 15, 2, 0, 0, 0, time.UTC)
+	records := []replication.HistoryRecord{
+		{Hash: "aaa", File: "0001_first.rep", Database: "Test", RunID: "run1", Time: started},
+		{Hash: "bbb", File: "0002_second.rep", Database: "Other", RunID: "run1", Time: started},
+		{Hash: "ccc", File: "0003_third.rep", Database: "TEST", RunID: "run2", Time: started.Add(time.Hour)},
+	}
+	for _, record := range records {
+		if err = history.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"); len(lines) != len(records) {
+		t.Errorf("history has %d lines, want a line per record:\n%s", len(lines), content)
+	}
+
+	tests := []struct {
+		hash string
+		want string
+	}{
+		{"aaa", "0001_first.rep"},
+		// the replication applied to another database
+		{"bbb", ""},
+		// the database name is case insensitive
+		{"ccc", "0003_third.rep"},
+		{"ddd", ""},
+	}
+	for _, tt := range tests {
+		record, err := history.Find(tt.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if record != nil {
+			got = record.File
+		}
+		if got != tt.want {
+			t.Errorf("Find(%q) = %q, want %q", tt.hash, got, tt.want)
+		}
+	}
+
+	if record, _ = history.Find("aaa"); record == nil || !record.Time.Equal(started) || record.RunID != "run1" {
+		t.Errorf("Find() = %+v, want the record as it was added", record)
+	}
+}
+
+func TestFileHistoryForgetsRun(t *testing.T) {
+	dir := t.TempDir()
+	history := replication.NewFileHistory(dir, "Test")
+	for _, record := range []replication.HistoryRecord{
+		{Hash: "aaa", Database: "Test", RunID: "run1"},
+		{Hash: "bbb", Database: "Other", RunID: "run1"},
+		{Hash: "ccc", Database: "Test", RunID: "run2"},
+	} {
+		if err := history.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := history.Forget("run1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if record, _ := history.Find("aaa"); record != nil {
+		t.Errorf("the forgotten record is found: %+v", record)
+	}
+	if record, _ := history.Find("ccc"); record == nil {
+		t.Error("the record of another run is forgotten")
+	}
+	// the run of another database is kept
+	other := replication.NewFileHistory(dir, "Other")
+	if record, _ := other.Find("bbb"); record == nil {
+		t.Error("the record of another database is forgotten")
+	}
+}
+
+func TestFileHistorySkipsBrokenLines(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"Hash":"aaa","File":"0001_first.rep","Database":"Test","RunID":"run1"}
+{"Hash":"bbb","File":"0002_sec
+{"Hash":"ccc","File":"0003_third.rep","Database":"Test","RunID":"run1"}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "history.jsonl"), []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	history := replication.NewFileHistory(dir, "Test")
+	for _, hash := range []string{"aaa", "ccc"} {
+		if record, err := history.Find(hash); err != nil || record == nil {
+			t.Errorf("Find(%q) = %+v, %v, want the record after the broken line", hash, record, err)
+		}
+	}
+}
+
+func TestFileHash(t *testing.T) {
+	dir := t.TempDir()
+	first, renamed := filepath.Join(dir, "0001_first.rep"), filepath.Join(dir, "0005_renamed.rep")
+	for _, path := range []string{first, renamed} {
+		if err := ioutil.WriteFile(path, []byte("replication"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash, err := replication.FileHash(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sha256sum of "replication"
+	if want := "fbe01a3d8ed259080b919baa08aa19645dc13cbc905e6501a5b3d2bb95aea4e6"; hash != want {
+		t.Errorf("FileHash() = %q, want %q", hash, want)
+	}
+
+	renamedHash, err := replication.FileHash(renamed)
+	if err != nil || renamedHash != hash {
+		t.Errorf("hash of the same content under another name = %q, %v, want %q", renamedHash, err, hash)
+	}
+
+	if _, err = replication.FileHash(filepath.Join(dir, "missing.rep")); !os.IsNotExist(err) {
+		t.Errorf("FileHash() of the missing file error = %v, want not exist", err)
+	}
+}
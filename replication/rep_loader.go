@@ -1,12 +1,159 @@
 package replication
 
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
 // ReplicationLoader provides an ability
 // to load replication via InnerReplication
 type ReplicationLoader struct {
 	FileLoader
 }
 
+// Replication is a replication file prepared for the import
+type Replication struct {
+	Path     string
+	Sequence int
+	// Package is the path to the package containing the replication, empty for a bare file
+	Package string
+	// Hash is SHA-256 of the content, it's set when the history is checked
+	Hash string
+}
+
+// Name returns the file name of the replication
+func (r Replication) Name() string {
+	return filepath.Base(r.Path)
+}
+
 // GetReplicationFiles looks for files with *.rep pattern
-func (loader *ReplicationLoader) GetReplicationFiles() []string {
+func (loader *ReplicationLoader) GetReplicationFiles() ([]string, error) {
 	return loader.GetFiles("*.rep")
 }
+
+// GetReplications returns bare replication files and replications of packages in order of installation.
+// Packages are installed as a whole. All packages are verified and extracted, their descriptions
+// are put to the replication directory. Nothing is extracted in preview mode.
+func (loader *ReplicationLoader) GetReplications(target Target, order OrderStrategy, preview bool) ([]Replication, error) {
+	units, err := loader.getUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	// the order is checked before anything is extracted
+	units, err = loader.orderUnits(units, order)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Replication
+	for _, u := range units {
+		if u.pkg != nil {
+			if err = loader.preparePackage(u.pkg, target, preview); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, u.replications...)
+	}
+	return result, nil
+}
+
+func (loader *ReplicationLoader) getUnits() ([]*unit, error) {
+	var result []*unit
+
+	files, err := loader.GetReplicationFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		fi, err := getFileInfo(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &unit{
+			path:         file,
+			modTime:      fi.ModTime(),
+			replications: []Replication{{Path: file}},
+		})
+	}
+
+	packages, err := loader.GetFiles(packagePattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range packages {
+		fi, err := getFileInfo(path)
+		if err != nil {
+			return nil, err
+		}
+		p, err := OpenPackage(path)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &unit{
+			path:         path,
+			modTime:      fi.ModTime(),
+			replications: p.Replications(loader.StagingDirectory(path)),
+			pkg:          p,
+		})
+	}
+
+	return result, nil
+}
+
+func (loader *ReplicationLoader) preparePackage(p *Package, target Target, preview bool) error {
+	var err error
+	dir := loader.StagingDirectory(p.Path)
+	if preview {
+		err = p.Verify(target)
+	} else {
+		err = p.Extract(target, dir)
+	}
+	if err != nil {
+		return err
+	}
+	loader.log.Info("The package ", p.Path, " is verified")
+
+	if preview {
+		return nil
+	}
+	return loader.publishDescriptions(p, dir)
+}
+
+// publishDescriptions moves descriptions of the package to the replication directory,
+// so they are sent by email as descriptions of bare replications
+func (loader *ReplicationLoader) publishDescriptions(p *Package, dir string) error {
+	for _, f := range p.Manifest.Files {
+		if filepath.Ext(f.Name) != ".desc" {
+			continue
+		}
+		err := os.Rename(filepath.Join(dir, f.Name), filepath.Join(loader.ReplicationDirectory, f.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StagingDirectory returns the directory where the package is extracted
+func (loader *ReplicationLoader) StagingDirectory(packagePath string) string {
+	name := filepath.Base(packagePath)
+	name = name[:len(name)-len(filepath.Ext(name))]
+	return filepath.Join(loader.ReplicationDirectory, stagingDirectory, name)
+}
+
+// RemoveStaging removes extracted files of the package
+func (loader *ReplicationLoader) RemoveStaging(packagePath string) error {
+	return os.RemoveAll(loader.StagingDirectory(packagePath))
+}
+
+func isReplicationFile(file string) bool {
+	return filepath.Ext(file) == ".rep"
+}
+
+func sortBySequence(replications []Replication) {
+	sort.SliceStable(replications, func(i, j int) bool {
+		return replications[i].Sequence < replications[j].Sequence
+	})
+}
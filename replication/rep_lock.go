@@ -0,0 +1,209 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lockFileName = "loader.lock"
+	// staleLockAge is the age after which the lock of another host is considered abandoned
+	staleLockAge = 24 * time.Hour
+	// brokenLockAge is the age after which the lock file which can't be read is considered abandoned.
+	// The younger one may be just created by another loader, which hasn't written it yet.
+	brokenLockAge = time.Minute
+	// processStartAccuracy is the error of the process start time,
+	// e.g. the boot time in /proc is rounded to seconds
+	processStartAccuracy = time.Second
+)
+
+// ErrLocked is returned when the replication directory is locked by another loader
+var ErrLocked = errors.New("the replication directory is locked by another loader")
+
+// errNoProcess is returned by processStarted if the process isn't running
+var errNoProcess = errors.New("the process isn't running")
+
+// LockInfo is the content of the lock file
+type LockInfo struct {
+	PID     int
+	Host    string
+	Started time.Time
+}
+
+// LockedError is returned when another loader holds the lock
+type LockedError struct {
+	Owner LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v: pid %d on host %s started at %s",
+		ErrLocked, e.Owner.PID, e.Owner.Host, e.Owner.Started.Format(time.RFC3339))
+}
+
+// Is allows to check the error by errors.Is(err, ErrLocked)
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Unlocker releases the lock
+type Unlocker interface {
+	Unlock() error
+}
+
+// DirectoryLock is an exclusive lock of the replication directory held by the lock file
+type DirectoryLock struct {
+	path string
+	info LockInfo
+	// started returns the start time of the process, it's replaced in tests
+	started func(pid int) (time.Time, error)
+}
+
+// Lock creates the lock file in the replication directory.
+// The lock left by a dead process of this host or of another host older than a day is removed,
+// as well as the lock file which can't be read for longer than a minute.
+func (file *FileLoader) Lock() (Unlocker, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &DirectoryLock{
+		path:    filepath.Join(file.ReplicationDirectory, lockFileName),
+		info:    LockInfo{os.Getpid(), host, time.Now()},
+		started: processStarted,
+	}
+
+	err = lock.create()
+	if !os.IsExist(err) {
+		return lockResult(lock, err)
+	}
+
+	owner, err := readLockInfo(lock.path)
+	switch {
+	case err == nil && !lock.isStale(owner):
+		return nil, &LockedError{owner}
+	case err != nil:
+		owner, err = brokenLockInfo(lock.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		// the broken lock may be just created by another loader, which hasn't written it yet
+		if err == nil && time.Since(owner.Started) <= brokenLockAge {
+			return nil, &LockedError{owner}
+		}
+	}
+
+	file.log.Info("The stale lock ", lock.path, " is removed")
+	if err = removeStaleLock(lock.path); err != nil {
+		return nil, err
+	}
+
+	err = lock.create()
+	if os.IsExist(err) {
+		owner, _ = readLockInfo(lock.path)
+		return nil, &LockedError{owner}
+	}
+	return lockResult(lock, err)
+}
+
+// lockResult returns nil interface if the lock wasn't taken
+func lockResult(lock *DirectoryLock, err error) (Unlocker, error) {
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (lock *DirectoryLock) create() error {
+	content, err := json.Marshal(lock.info)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(lock.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(lock.path)
+	}
+	return err
+}
+
+// isStale returns true if the owner of the lock can't be running anymore.
+// The pid of the dead owner may be reused, so the process started after the lock isn't its owner.
+// The process which can't be checked, e.g. access to it is denied, is considered running.
+// The lock of another host or whose owner start time is unknown is stale when it's older than a day.
+func (lock *DirectoryLock) isStale(owner LockInfo) bool {
+	if owner.Host != lock.info.Host {
+		return time.Since(owner.Started) > staleLockAge
+	}
+
+	started, err := lock.started(owner.PID)
+	switch {
+	case errors.Is(err, errNoProcess):
+		return true
+	case err != nil:
+		return false
+	case started.IsZero():
+		return time.Since(owner.Started) > staleLockAge
+	}
+	return started.After(owner.Started.Add(processStartAccuracy))
+}
+
+// removeStaleLock renames the lock file before removing,
+// so only one of loaders removing the stale lock at the same time succeeds
+func removeStaleLock(path string) error {
+	stale := fmt.Sprintf("%s.%d.stale", path, os.Getpid())
+	if err := os.Rename(path, stale); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.Remove(stale)
+}
+
+func readLockInfo(path string) (LockInfo, error) {
+	var info LockInfo
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+
+	err = json.Unmarshal(content, &info)
+	return info, err
+}
+
+// brokenLockInfo describes the lock file which can't be read by its modification time
+func brokenLockInfo(path string) (LockInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return LockInfo{}, err
+	}
+	return LockInfo{Host: "unknown", Started: fi.ModTime()}, nil
+}
+
+// Unlock removes the lock file if it still belongs to this loader
+func (lock *DirectoryLock) Unlock() error {
+	owner, err := readLockInfo(lock.path)
+	if err != nil {
+		return err
+	}
+
+	if owner.PID != lock.info.PID || owner.Host != lock.info.Host || !owner.Started.Equal(lock.info.Started) {
+		return fmt.Errorf("the lock %s was taken over by pid %d on host %s", lock.path, owner.PID, owner.Host)
+	}
+	return os.Remove(lock.path)
+}
@@ -0,0 +1,72 @@
+package replication
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLockIsStale(t *testing.T) {
+	now := time.Now()
+	lockStarted := now.Add(-time.Hour)
+	accessDenied := errors.New("access is denied")
+
+	tests := []struct {
+		name    string
+		owner   LockInfo
+		started time.Time
+		err     error
+		want    bool
+	}{
+		{"another host", LockInfo{1, "other", lockStarted}, time.Time{}, errNoProcess, false},
+		{"old lock of another host", LockInfo{1, "other", now.Add(-25 * time.Hour)}, time.Time{}, nil, true},
+		{"running owner", LockInfo{1, "local", lockStarted}, lockStarted.Add(-time.Second), nil, false},
+		{"dead owner", LockInfo{1, "local", lockStarted}, time.Time{}, errNoProcess, true},
+		{"reused pid", LockInfo{1, "local", lockStarted}, lockStarted.Add(time.Minute), nil, true},
+		{"start time rounded", LockInfo{1, "local", lockStarted}, lockStarted.Add(time.Millisecond), nil, false},
+		{"access denied", LockInfo{1, "local", now.Add(-25 * time.Hour)}, time.Time{}, accessDenied, false},
+		{"unknown start time", LockInfo{1, "local", lockStarted}, time.Time{}, nil, false},
+		{"old lock with unknown start time", LockInfo{1, "local", now.Add(-25 * time.Hour)}, time.Time{}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &DirectoryLock{
+				info: LockInfo{2, "local", now},
+				started: func(pid int) (time.Time, error) {
+					if pid != tt.owner.PID {
+						t.Errorf("start time of pid %d is requested, want %d", pid, tt.owner.PID)
+					}
+					return tt.started, tt.err
+				},
+			}
+			if got := lock.isStale(tt.owner); got != tt.want {
+				t.Errorf("isStale() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockOfRunningLoaderIsNotStale(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock := &DirectoryLock{info: LockInfo{0, host, time.Now()}, started: processStarted}
+	owner := LockInfo{os.Getpid(), host, time.Now()}
+	if lock.isStale(owner) {
+		t.Error("the lock of this process is stale")
+	}
+
+	// the process started after the lock was taken has reused the pid of its dead owner
+	owner.Started = time.Now().Add(-24 * time.Hour)
+	started, err := processStarted(owner.PID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !started.IsZero() && !lock.isStale(owner) {
+		t.Errorf("the lock taken before the process started at %s isn't stale", started)
+	}
+}
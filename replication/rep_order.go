@@ -0,0 +1,300 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderStrategy defines the order in which replications are installed
+type OrderStrategy string
+
+const (
+	// OrderSequence installs replications by sequence numbers of their file names, e.g. 0009_fix.rep
+	OrderSequence OrderStrategy = "sequence"
+	// OrderDependency installs replications after the ones declared in manifests as their dependencies
+	OrderDependency OrderStrategy = "dependency"
+	// OrderModTime installs replications by modification time of their files
+	OrderModTime OrderStrategy = "mtime"
+)
+
+// ErrInvalidOrder is returned when the order of replications can't be determined unambiguously
+var ErrInvalidOrder = errors.New("replications couldn't be ordered")
+
+var sequencePrefix = regexp.MustCompile(`^(\d+)`)
+
+// ParseOrder converts the name of the strategy to OrderStrategy
+func ParseOrder(name string) (OrderStrategy, error) {
+	order := OrderStrategy(strings.ToLower(strings.TrimSpace(name)))
+	switch order {
+	case "":
+		// the modification time was the only order before strategies were added
+		return OrderModTime, nil
+	case OrderSequence, OrderDependency, OrderModTime:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown order %q, expected %s, %s or %s",
+			name, OrderSequence, OrderDependency, OrderModTime)
+	}
+}
+
+// unit is a bare replication file or a package, it's installed as a whole
+type unit struct {
+	path         string
+	modTime      time.Time
+	replications []Replication
+	pkg          *Package
+}
+
+func (u *unit) name() string {
+	return filepath.Base(u.path)
+}
+
+// sequences returns the first and the last sequence numbers of replications of the unit.
+// A package takes the numbers of its manifest, e.g. release.zip with 0003_a.rep and 0004_b.rep
+// goes between 0002_c.rep and 0005_d.rep. The number its file name starts with is used
+// only if the manifest has no sequence numbers. A bare file takes the number its name starts with.
+func (u *unit) sequences() (first, last int, ok bool) {
+	if u.pkg != nil && len(u.replications) > 0 && u.replications[0].Sequence > 0 {
+		return u.replications[0].Sequence, u.replications[len(u.replications)-1].Sequence, true
+	}
+
+	match := sequencePrefix.FindString(u.name())
+	if match == "" {
+		return 0, 0, false
+	}
+	seq, err := strconv.Atoi(match)
+	return seq, seq, err == nil
+}
+
+// dependencies returns the names of replications the unit depends on
+func (u *unit) dependencies() []string {
+	if u.pkg == nil {
+		return nil
+	}
+
+	var result []string
+	for _, f := range u.pkg.Manifest.Files {
+		result = append(result, f.DependsOn...)
+	}
+	return result
+}
+
+func (loader *ReplicationLoader) orderUnits(units []*unit, order OrderStrategy) ([]*unit, error) {
+	// the natural order of names makes ties deterministic
+	sort.SliceStable(units, func(i, j int) bool {
+		return naturalLess(units[i].name(), units[j].name())
+	})
+
+	switch order {
+	case OrderSequence:
+		return orderBySequence(units)
+	case OrderDependency:
+		return loader.orderByDependencies(units)
+	default:
+		orderByModTime(units)
+		return units, nil
+	}
+}
+
+func orderByModTime(units []*unit) {
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].modTime.Before(units[j].modTime)
+	})
+}
+
+// orderBySequence sorts units by sequence numbers of their names or package manifests.
+// Sequence numbers must be unique and consecutive across all units.
+// Units without a sequence number go after numbered ones in order of their modification time.
+func orderBySequence(units []*unit) ([]*unit, error) {
+	firsts := make(map[*unit]int, len(units))
+	lasts := make(map[*unit]int, len(units))
+	var numbered, unnumbered []*unit
+	for _, u := range units {
+		first, last, ok := u.sequences()
+		if !ok {
+			unnumbered = append(unnumbered, u)
+			continue
+		}
+		firsts[u], lasts[u] = first, last
+		numbered = append(numbered, u)
+
+		if u.pkg != nil {
+			if err := checkSequences(u.name(), u.replications); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(numbered, func(i, j int) bool {
+		return firsts[numbered[i]] < firsts[numbered[j]]
+	})
+
+	for i := 1; i < len(numbered); i++ {
+		prev, cur := numbered[i-1], numbered[i]
+		switch {
+		case firsts[cur] <= lasts[prev]:
+			return nil, fmt.Errorf("%w: %s and %s have the same sequence number %d",
+				ErrInvalidOrder, prev.name(), cur.name(), firsts[cur])
+		case firsts[cur] != lasts[prev]+1:
+			return nil, fmt.Errorf("%w: sequence numbers between %s and %s are missing",
+				ErrInvalidOrder, prev.name(), cur.name())
+		}
+	}
+
+	orderByModTime(unnumbered)
+	return append(numbered, unnumbered...), nil
+}
+
+// checkSequences checks that replications of the package, which are sorted by sequence, have no gaps
+func checkSequences(pkg string, replications []Replication) error {
+	for i := 1; i < len(replications); i++ {
+		if replications[i].Sequence != replications[i-1].Sequence+1 {
+			return fmt.Errorf("%w: sequence numbers between %s and %s of the package %s are missing",
+				ErrInvalidOrder, replications[i-1].Name(), replications[i].Name(), pkg)
+		}
+	}
+	return nil
+}
+
+// orderByDependencies sorts units topologically by dependencies declared in package manifests.
+// Units which don't depend on each other keep the natural order of their names.
+// Dependencies missing in the replication directory are considered installed earlier.
+func (loader *ReplicationLoader) orderByDependencies(units []*unit) ([]*unit, error) {
+	owners := map[string]*unit{}
+	for _, u := range units {
+		for _, rep := range u.replications {
+			owners[strings.ToLower(rep.Name())] = u
+		}
+	}
+
+	required := make(map[*unit]map[*unit]bool, len(units))
+	for _, u := range units {
+		required[u] = map[*unit]bool{}
+		if err := checkInnerDependencies(u); err != nil {
+			return nil, err
+		}
+
+		for _, dep := range u.dependencies() {
+			owner, ok := owners[strings.ToLower(dep)]
+			switch {
+			case !ok:
+				loader.log.Info("The replication ", dep, " required by ", u.name(),
+					" isn't found, it's considered installed")
+			case owner != u:
+				required[u][owner] = true
+			}
+		}
+	}
+
+	result := make([]*unit, 0, len(units))
+	installed := map[*unit]bool{}
+	for len(result) < len(units) {
+		next := nextReady(units, required, installed)
+		if next == nil {
+			return nil, fmt.Errorf("%w: dependencies of %s are circular",
+				ErrInvalidOrder, strings.Join(pendingNames(units, installed), ", "))
+		}
+		installed[next] = true
+		result = append(result, next)
+	}
+	return result, nil
+}
+
+// nextReady returns the first unit which dependencies are installed
+func nextReady(units []*unit, required map[*unit]map[*unit]bool, installed map[*unit]bool) *unit {
+	for _, u := range units {
+		if installed[u] {
+			continue
+		}
+
+		ready := true
+		for dep := range required[u] {
+			if !installed[dep] {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return u
+		}
+	}
+	return nil
+}
+
+func pendingNames(units []*unit, installed map[*unit]bool) []string {
+	var result []string
+	for _, u := range units {
+		if !installed[u] {
+			result = append(result, u.name())
+		}
+	}
+	return result
+}
+
+// checkInnerDependencies checks that replications of the package
+// depend only on the ones installed before them
+func checkInnerDependencies(u *unit) error {
+	if u.pkg == nil {
+		return nil
+	}
+
+	sequences := map[string]int{}
+	for _, f := range u.pkg.Manifest.Files {
+		sequences[strings.ToLower(f.Name)] = f.Sequence
+	}
+
+	for _, f := range u.pkg.Manifest.Files {
+		for _, dep := range f.DependsOn {
+			seq, ok := sequences[strings.ToLower(dep)]
+			if ok && seq >= f.Sequence {
+				return fmt.Errorf("%w: %s of the package %s depends on %s installed after it",
+					ErrInvalidOrder, f.Name, u.name(), dep)
+			}
+		}
+	}
+	return nil
+}
+
+// naturalLess compares names treating digit runs as numbers, so 9_a.rep goes before 10_a.rep
+func naturalLess(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, restA := splitDigits(a)
+			nb, restB := splitDigits(b)
+			trimmedA, trimmedB := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(trimmedA) != len(trimmedB) {
+				return len(trimmedA) < len(trimmedB)
+			}
+			if trimmedA != trimmedB {
+				return trimmedA < trimmedB
+			}
+			a, b = restA, restB
+			continue
+		}
+
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
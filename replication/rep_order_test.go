@@ -0,0 +1,202 @@
+package replication
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var orderStart = time.Date(2024, time.June, 15, 2, 0, 0, 0, time.UTC)
+
+// bareUnit is the replication file modified minutes after orderStart
+func bareUnit(name string, minutes int) *unit {
+	return &unit{
+		path:         name,
+		modTime:      orderStart.Add(time.Duration(minutes) * time.Minute),
+		replications: []Replication{{Path: name}},
+	}
+}
+
+// packageUnit is the package with the manifest of files
+func packageUnit(name string, files ...ManifestFile) *unit {
+	p := &Package{Path: name, Manifest: Manifest{Database: "Test", Files: files}}
+	return &unit{path: name, modTime: orderStart, replications: p.Replications(""), pkg: p}
+}
+
+func unitNames(units []*unit) []string {
+	var result []string
+	for _, u := range units {
+		result = append(result, u.name())
+	}
+	return result
+}
+
+func TestOrderUnits(t *testing.T) {
+	tests := []struct {
+		name  string
+		order OrderStrategy
+		units []*unit
+		want  []string
+		// err is a part of the error message, the order is expected to fail if it's set
+		err string
+	}{
+		{
+			name:  "natural order of mixed widths",
+			order: OrderSequence,
+			units: []*unit{bareUnit("10_b.rep", 0), bareUnit("9_a.rep", 1), bareUnit("11_c.rep", 2)},
+			want:  []string{"9_a.rep", "10_b.rep", "11_c.rep"},
+		},
+		{
+			name:  "leading zeros",
+			order: OrderSequence,
+			units: []*unit{bareUnit("0010_b.rep", 0), bareUnit("9_a.rep", 1)},
+			want:  []string{"9_a.rep", "0010_b.rep"},
+		},
+		{
+			name:  "unnumbered go last by modification time",
+			order: OrderSequence,
+			units: []*unit{bareUnit("fix.rep", 5), bareUnit("2_b.rep", 9), bareUnit("hotfix.rep", 1), bareUnit("1_a.rep", 9)},
+			want:  []string{"1_a.rep", "2_b.rep", "hotfix.rep", "fix.rep"},
+		},
+		{
+			name:  "gap",
+			order: OrderSequence,
+			units: []*unit{bareUnit("0001_a.rep", 0), bareUnit("0003_c.rep", 0)},
+			err:   "sequence numbers between 0001_a.rep and 0003_c.rep are missing",
+		},
+		{
+			name:  "duplicate",
+			order: OrderSequence,
+			units: []*unit{bareUnit("0001_a.rep", 0), bareUnit("1_b.rep", 0)},
+			err:   "0001_a.rep and 1_b.rep have the same sequence number 1",
+		},
+		{
+			name:  "package between files by manifest sequences",
+			order: OrderSequence,
+			units: []*unit{
+				bareUnit("0005_e.rep", 0),
+				packageUnit("release.zip",
+					ManifestFile{Name: "0004_d.rep", Sequence: 4}, ManifestFile{Name: "0003_c.rep", Sequence: 3}),
+				bareUnit("0002_b.rep", 0),
+			},
+			want: []string{"0002_b.rep", "release.zip", "0005_e.rep"},
+		},
+		{
+			name:  "package overlapping a file",
+			order: OrderSequence,
+			units: []*unit{
+				bareUnit("0003_x.rep", 0),
+				packageUnit("release.zip",
+					ManifestFile{Name: "0002_b.rep", Sequence: 2}, ManifestFile{Name: "0003_c.rep", Sequence: 3}),
+			},
+			err: "release.zip and 0003_x.rep have the same sequence number 3",
+		},
+		{
+			name:  "package without manifest sequences by its name",
+			order: OrderSequence,
+			units: []*unit{
+				bareUnit("0003_c.rep", 0),
+				packageUnit("0002_release.zip", ManifestFile{Name: "b.rep"}),
+				bareUnit("0001_a.rep", 0),
+			},
+			want: []string{"0001_a.rep", "0002_release.zip", "0003_c.rep"},
+		},
+		{
+			name:  "gap in the package",
+			order: OrderSequence,
+			units: []*unit{
+				packageUnit("release.zip",
+					ManifestFile{Name: "0001_a.rep", Sequence: 1}, ManifestFile{Name: "0003_c.rep", Sequence: 3}),
+			},
+			err: "between 0001_a.rep and 0003_c.rep of the package release.zip are missing",
+		},
+		{
+			name:  "dependencies",
+			order: OrderDependency,
+			units: []*unit{
+				packageUnit("a.zip", ManifestFile{Name: "a.rep", Sequence: 1, DependsOn: []string{"C.rep"}}),
+				bareUnit("b.rep", 0),
+				packageUnit("c.zip", ManifestFile{Name: "c.rep", Sequence: 1}),
+			},
+			want: []string{"b.rep", "c.zip", "a.zip"},
+		},
+		{
+			name:  "missing dependency is considered installed",
+			order: OrderDependency,
+			units: []*unit{
+				packageUnit("b.zip", ManifestFile{Name: "b.rep", Sequence: 1, DependsOn: []string{"missing.rep"}}),
+				bareUnit("a.rep", 0),
+			},
+			want: []string{"a.rep", "b.zip"},
+		},
+		{
+			name:  "cycle",
+			order: OrderDependency,
+			units: []*unit{
+				packageUnit("a.zip", ManifestFile{Name: "a.rep", Sequence: 1, DependsOn: []string{"b.rep"}}),
+				packageUnit("b.zip", ManifestFile{Name: "b.rep", Sequence: 1, DependsOn: []string{"a.rep"}}),
+				bareUnit("c.rep", 0),
+			},
+			err: "dependencies of a.zip, b.zip are circular",
+		},
+		{
+			name:  "dependency inside the package installed later",
+			order: OrderDependency,
+			units: []*unit{
+				packageUnit("a.zip",
+					ManifestFile{Name: "a.rep", Sequence: 1, DependsOn: []string{"b.rep"}},
+					ManifestFile{Name: "b.rep", Sequence: 2}),
+			},
+			err: "a.rep of the package a.zip depends on b.rep installed after it",
+		},
+		{
+			name:  "modification time",
+			order: OrderModTime,
+			units: []*unit{bareUnit("1_a.rep", 2), bareUnit("2_b.rep", 1), bareUnit("3_c.rep", 1)},
+			want:  []string{"2_b.rep", "3_c.rep", "1_a.rep"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader := &ReplicationLoader{FileLoader{log: newTestLog(t)}}
+			got, err := loader.orderUnits(tt.units, tt.order)
+
+			if tt.err != "" {
+				if !errors.Is(err, ErrInvalidOrder) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("orderUnits() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := unitNames(got); !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("orderUnits() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"9_a.rep", "10_a.rep", true},
+		{"10_a.rep", "9_a.rep", false},
+		{"0009_a.rep", "10_a.rep", true},
+		{"a2.rep", "a10.rep", true},
+		{"A.rep", "b.rep", true},
+		{"a.rep", "a.rep", false},
+		{"a.rep", "a.rep.bak", true},
+	}
+
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package replication
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	packagePattern   = "*.zip"
+	manifestName     = "manifest.json"
+	stagingDirectory = "packages"
+)
+
+// ErrInvalidPackage is returned when the replication package fails verification
+var ErrInvalidPackage = errors.New("invalid replication package")
+
+// Manifest describes the content of the replication package
+type Manifest struct {
+	Database        string         `json:"database"`
+	MinEleedVersion string         `json:"minEleedVersion,omitempty"`
+	Files           []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a replication or a description file of the package
+type ManifestFile struct {
+	Name     string `json:"name"`
+	Sequence int    `json:"sequence,omitempty"`
+	SHA256   string `json:"sha256"`
+	// DependsOn lists replications which must be installed before this one
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// Target describes the installation the package is verified against
+type Target struct {
+	Database string
+	// Version returns the version of installed eLeed,
+	// it is called only if the package requires the minimal version
+	Version func() (string, error)
+}
+
+// Package is a zip archive with replications, their descriptions and manifest.json
+type Package struct {
+	Path     string
+	Manifest Manifest
+}
+
+// OpenPackage reads the manifest of the package
+func OpenPackage(path string) (*Package, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, packageError(path, "couldn't be opened: %v", err)
+	}
+	defer archive.Close()
+
+	p := &Package{Path: path}
+	for _, f := range archive.File {
+		if f.Name != manifestName {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, packageError(path, "manifest couldn't be read: %v", err)
+		}
+		if err = json.Unmarshal(content, &p.Manifest); err != nil {
+			return nil, packageError(path, "manifest couldn't be parsed: %v", err)
+		}
+		return p, nil
+	}
+
+	return nil, packageError(path, "has no %s", manifestName)
+}
+
+// Verify checks the manifest against the target installation
+// and checksums of all files of the package
+func (p *Package) Verify(target Target) error {
+	return p.unpack(target, "")
+}
+
+// Extract verifies the package and extracts its files to the directory.
+// The directory is removed if the package is invalid.
+func (p *Package) Extract(target Target, dir string) error {
+	err := p.unpack(target, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+	}
+	return err
+}
+
+// Replications returns replication files of the package in order of their sequence numbers
+func (p *Package) Replications(dir string) []Replication {
+	var result []Replication
+	for _, f := range p.Manifest.Files {
+		if isReplicationFile(f.Name) {
+			result = append(result, Replication{
+				Path:     filepath.Join(dir, f.Name),
+				Sequence: f.Sequence,
+				Package:  p.Path,
+			})
+		}
+	}
+	sortBySequence(result)
+	return result
+}
+
+func (p *Package) unpack(target Target, dir string) error {
+	if err := p.verifyManifest(target); err != nil {
+		return err
+	}
+
+	archive, err := zip.OpenReader(p.Path)
+	if err != nil {
+		return packageError(p.Path, "couldn't be opened: %v", err)
+	}
+	defer archive.Close()
+
+	checksums := map[string]string{}
+	for _, f := range p.Manifest.Files {
+		checksums[f.Name] = strings.ToLower(f.SHA256)
+	}
+
+	for _, f := range archive.File {
+		if f.Name == manifestName || f.FileInfo().IsDir() {
+			continue
+		}
+
+		expected, ok := checksums[f.Name]
+		if !ok {
+			return packageError(p.Path, "has the file %s missing in the manifest", f.Name)
+		}
+		delete(checksums, f.Name)
+
+		actual, err := p.unpackFile(f, dir)
+		if err != nil {
+			return packageError(p.Path, "file %s couldn't be unpacked: %v", f.Name, err)
+		}
+		if actual != expected {
+			return packageError(p.Path, "checksum of %s is %s, but %s is expected", f.Name, actual, expected)
+		}
+	}
+
+	// any file listed in the manifest but missing in the package is enough to reject it
+	for name := range checksums {
+		return packageError(p.Path, "has no file %s listed in the manifest", name)
+	}
+	return nil
+}
+
+func (p *Package) verifyManifest(target Target) error {
+	m := p.Manifest
+	if !strings.EqualFold(m.Database, target.Database) {
+		return packageError(p.Path, "is made for database %q, but the target is %q", m.Database, target.Database)
+	}
+
+	sequences := map[int]string{}
+	replications := 0
+	for _, f := range m.Files {
+		// names are used as paths, so they mustn't leave the directory
+		if f.Name == "" || f.Name != filepath.Base(filepath.Clean(f.Name)) {
+			return packageError(p.Path, "has invalid file name %q", f.Name)
+		}
+		if !isReplicationFile(f.Name) {
+			continue
+		}
+
+		replications++
+		if other, ok := sequences[f.Sequence]; ok {
+			return packageError(p.Path, "has files %s and %s with the same sequence %d", other, f.Name, f.Sequence)
+		}
+		sequences[f.Sequence] = f.Name
+	}
+	if replications == 0 {
+		return packageError(p.Path, "has no replication files")
+	}
+
+	if m.MinEleedVersion == "" {
+		return nil
+	}
+	if target.Version == nil {
+		return packageError(p.Path, "requires eLeed %s, but the installed version is unknown", m.MinEleedVersion)
+	}
+	version, err := target.Version()
+	if err != nil {
+		return packageError(p.Path, "requires eLeed %s, but the installed version is unknown: %v", m.MinEleedVersion, err)
+	}
+	if compareVersions(version, m.MinEleedVersion) < 0 {
+		return packageError(p.Path, "requires eLeed %s, but %s is installed", m.MinEleedVersion, version)
+	}
+	return nil
+}
+
+// unpackFile calculates SHA-256 of the file and writes it to the directory if it is set
+func (p *Package) unpackFile(f *zip.File, dir string) (string, error) {
+	src, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	var dst io.Writer = hash
+
+	if dir != "" {
+		if err = createDirectory(dir); err != nil {
+			return "", err
+		}
+		file, err := os.Create(filepath.Join(dir, f.Name))
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		dst = io.MultiWriter(hash, file)
+	}
+
+	if _, err = io.Copy(dst, src); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	src, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return ioutil.ReadAll(src)
+}
+
+func packageError(path string, format string, args ...interface{}) error {
+	return fmt.Errorf("%w %s: %s", ErrInvalidPackage, filepath.Base(path), fmt.Sprintf(format, args...))
+}
+
+// compareVersions compares dotted numeric versions like 4.2.10
+func compareVersions(a, b string) int {
+	left, right := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(left) || i < len(right); i++ {
+		l, r := versionPart(left, i), versionPart(right, i)
+		if l != r {
+			if l < r {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	v, _ := strconv.Atoi(strings.TrimSpace(parts[i]))
+	return v
+}
@@ -0,0 +1,193 @@
+package replication_test
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergeyzalunin/go-replication-loader/replication"
+)
+
+var packageFiles = map[string]string{
+	"0002_prices.rep":  "prices",
+	"0001_orders.rep":  "orders",
+	"0001_orders.desc": "Orders form",
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// validManifest lists all package files with their checksums
+func validManifest() replication.Manifest {
+	return replication.Manifest{
+		Database: "Test",
+		Files: []replication.ManifestFile{
+			{Name: "0002_prices.rep", Sequence: 2, SHA256: checksum("prices"), DependsOn: []string{"0001_orders.rep"}},
+			{Name: "0001_orders.rep", Sequence: 1, SHA256: strings.ToUpper(checksum("orders"))},
+			{Name: "0001_orders.desc", SHA256: checksum("Orders form")},
+		},
+	}
+}
+
+// writePackage writes the zip archive with the manifest and files and opens it
+func writePackage(t *testing.T, manifest replication.Manifest, files map[string]string) *replication.Package {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "release.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["manifest.json"] = string(content)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := replication.OpenPackage(path)
+	if err != nil {
+		t.Fatalf("OpenPackage() error = %v", err)
+	}
+	return p
+}
+
+func copyFiles(files map[string]string) map[string]string {
+	result := map[string]string{}
+	for name, content := range files {
+		result[name] = content
+	}
+	return result
+}
+
+func TestPackageExtract(t *testing.T) {
+	p := writePackage(t, validManifest(), copyFiles(packageFiles))
+	dir := filepath.Join(t.TempDir(), "staging")
+
+	if err := p.Extract(replication.Target{Database: "test"}, dir); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	for name, want := range packageFiles {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Errorf("extracted %s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	want := []replication.Replication{
+		{Path: filepath.Join(dir, "0001_orders.rep"), Sequence: 1, Package: p.Path},
+		{Path: filepath.Join(dir, "0002_prices.rep"), Sequence: 2, Package: p.Path},
+	}
+	if got := p.Replications(dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("Replications() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPackageVerifyRejectsInvalidPackages(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(m *replication.Manifest, files map[string]string)
+		want   string
+	}{
+		{
+			name: "tampered entry",
+			change: func(m *replication.Manifest, files map[string]string) {
+				files["0002_prices.rep"] = "prices changed after signing"
+			},
+			want: "checksum of 0002_prices.rep",
+		},
+		{
+			name: "missing entry",
+			change: func(m *replication.Manifest, files map[string]string) {
+				delete(files, "0001_orders.desc")
+			},
+			want: "has no file 0001_orders.desc listed in the manifest",
+		},
+		{
+			name: "extra entry",
+			change: func(m *replication.Manifest, files map[string]string) {
+				files["0003_injected.rep"] = "injected"
+			},
+			want: "has the file 0003_injected.rep missing in the manifest",
+		},
+		{
+			name: "another database",
+			change: func(m *replication.Manifest, files map[string]string) {
+				m.Database = "Production"
+			},
+			want: `is made for database "Production"`,
+		},
+		{
+			name: "name leaving the directory",
+			change: func(m *replication.Manifest, files map[string]string) {
+				m.Files[0].Name = "../0002_prices.rep"
+			},
+			want: "has invalid file name",
+		},
+		{
+			name: "same sequence",
+			change: func(m *replication.Manifest, files map[string]string) {
+				m.Files[0].Sequence = 1
+			},
+			want: "with the same sequence 1",
+		},
+		{
+			name: "newer eLeed required",
+			change: func(m *replication.Manifest, files map[string]string) {
+				m.MinEleedVersion = "5.10"
+			},
+			want: "requires eLeed 5.10, but 5.9.1 is installed",
+		},
+	}
+
+	target := replication.Target{
+		Database: "Test",
+		Version:  func() (string, error) { return "5.9.1", nil },
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, files := validManifest(), copyFiles(packageFiles)
+			tt.change(&manifest, files)
+			p := writePackage(t, manifest, files)
+
+			err := p.Verify(target)
+			if !errors.Is(err, replication.ErrInvalidPackage) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Verify() error = %v, want ErrInvalidPackage with %q", err, tt.want)
+			}
+
+			dir := filepath.Join(t.TempDir(), "staging")
+			if err = p.Extract(target, dir); !errors.Is(err, replication.ErrInvalidPackage) {
+				t.Errorf("Extract() error = %v, want ErrInvalidPackage", err)
+			}
+			if _, err = os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("the staging directory is left after the invalid package: %v", err)
+			}
+		})
+	}
+}
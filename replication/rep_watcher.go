@@ -0,0 +1,219 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
+)
+
+const (
+	// minWatchInterval prevents busy polling when the interval isn't set
+	minWatchInterval = time.Second
+	// installation failed by a transient error is repeated with these delays
+	installAttempts     = 5
+	installRetryDelay   = time.Minute
+	installRetryMaxWait = 30 * time.Minute
+)
+
+// watchPatterns are files which are waited to be copied completely before the installation
+var watchPatterns = []string{"*.rep", "*.desc", packagePattern}
+
+// InstallFunc installs replications found by Watcher
+type InstallFunc func(ctx context.Context) error
+
+// PostponedError is returned by InstallFunc if the installation isn't allowed until the time
+type PostponedError struct {
+	Until time.Time
+}
+
+func (e *PostponedError) Error() string {
+	return fmt.Sprintf("the installation is postponed until %s", e.Until.Format(time.RFC3339))
+}
+
+// Watcher polls the replication directory and starts the installation
+// when replication files appear and stop changing
+type Watcher struct {
+	log      *logger.Log
+	repl     *ReplicationLoader
+	Interval time.Duration
+	Settle   time.Duration
+	// Retry repeats the installation failed by a transient error with growing delays
+	Retry retry.Policy
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+type snapshot map[string]fileState
+
+// NewWatcher is a constructor for Watcher.
+// Files are considered copied if they haven't changed during settle duration.
+// Installations failed by errors which are retryable are repeated, retry.Transient is used if it isn't set.
+func NewWatcher(repl *ReplicationLoader, interval, settle time.Duration,
+	retryable retry.Classifier, log *logger.Log) *Watcher {
+	if interval < minWatchInterval {
+		interval = minWatchInterval
+	}
+	if retryable == nil {
+		retryable = retry.Transient
+	}
+
+	policy := retry.NewPolicy("The installation started by watcher", retryable)
+	policy.MaxAttempts = installAttempts
+	policy.InitialDelay = installRetryDelay
+	policy.MaxDelay = installRetryMaxWait
+
+	return &Watcher{log, repl, interval, settle, policy}
+}
+
+// Watch polls the replication directory until the context is cancelled.
+// The installation runs in the same goroutine, so two installations never run at once.
+// Files left after a failed installation aren't installed again until they are changed,
+// unless the error is transient. Then the installation is repeated with growing delays.
+func (w *Watcher) Watch(ctx context.Context, install InstallFunc) {
+	w.log.Info("Watching the directory ", w.repl.ReplicationDirectory, " for new replications")
+
+	state := &watchState{}
+	for {
+		current, err := w.snapshot()
+		if err != nil {
+			w.log.Error(err, "Failed to check the replication directory")
+		}
+		w.check(ctx, state, current, err, time.Now(), install)
+
+		select {
+		case <-ctx.Done():
+			w.log.Info("Watching the directory ", w.repl.ReplicationDirectory, " is stopped")
+			return
+		case <-time.After(w.Interval):
+		}
+	}
+}
+
+// watchState is what the watcher knows about files of the replication directory between checks
+type watchState struct {
+	last, installed snapshot
+	changedAt       time.Time
+	postponedUntil  time.Time
+	retryAt         time.Time
+	// failures is the number of installations of the same files failed in a row
+	failures int
+}
+
+// check compares the current snapshot with the previous one
+// and installs replications which haven't changed during the settle duration
+func (w *Watcher) check(ctx context.Context, state *watchState, current snapshot, err error,
+	now time.Time, install InstallFunc) {
+	switch {
+	case err != nil || !current.hasReplications():
+		state.last, state.installed = nil, nil
+		state.retryAt, state.failures = time.Time{}, 0
+	case !current.equal(state.last):
+		state.last, state.changedAt = current, now
+		state.retryAt, state.failures = time.Time{}, 0
+		w.log.Info("New replication files are found, waiting until they stop changing")
+	case current.equal(state.installed) && (state.retryAt.IsZero() || now.Before(state.retryAt)):
+		// the previous installation of these files has failed and isn't retried yet or at all
+	case now.Sub(state.changedAt) >= w.Settle && now.After(state.postponedUntil):
+		state.installed = current
+		err = install(ctx)
+		state.postponedUntil, state.retryAt = w.postpone(err, now), time.Time{}
+		switch {
+		case !state.postponedUntil.IsZero():
+			state.installed, state.failures = nil, 0
+		case err != nil:
+			state.failures++
+			state.retryAt = w.retryAt(err, state.failures, now)
+		default:
+			state.failures = 0
+		}
+	}
+}
+
+// postpone returns the time until which the installation is postponed
+// or zero time if it isn't postponed
+func (w *Watcher) postpone(err error, now time.Time) time.Time {
+	var postponed *PostponedError
+	if !errors.As(err, &postponed) {
+		w.log.LogIfError(err, "The installation started by watcher failed")
+		return time.Time{}
+	}
+
+	until := postponed.Until
+	if until.IsZero() {
+		until = now.Add(w.Settle)
+	}
+	w.log.Info("The installation is postponed until ", until.Format(time.RFC3339))
+	return until
+}
+
+// retryAt returns the time of the next attempt of the installation failed by the transient error
+// or zero time if it isn't repeated
+func (w *Watcher) retryAt(err error, failures int, now time.Time) time.Time {
+	if !w.Retry.Retryable(err) {
+		return time.Time{}
+	}
+	if failures >= w.Retry.MaxAttempts {
+		w.log.Info(w.Retry.Name, ": attempt ", failures, " failed, no attempts left. ",
+			"The replications are installed again when they change")
+		return time.Time{}
+	}
+
+	delay := w.Retry.Delay(failures)
+	w.log.Info(w.Retry.Name, ": attempt ", failures, " of ", w.Retry.MaxAttempts,
+		" failed by the transient error, next attempt in ", delay.Round(time.Second))
+	return now.Add(delay)
+}
+
+func (w *Watcher) snapshot() (snapshot, error) {
+	result := snapshot{}
+
+	for _, pattern := range watchPatterns {
+		files, err := w.repl.GetFiles(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			fi, err := os.Stat(file)
+			if err != nil {
+				// the file was removed or renamed since it was found
+				continue
+			}
+			result[file] = fileState{fi.Size(), fi.ModTime()}
+		}
+	}
+
+	return result, nil
+}
+
+func (s snapshot) hasReplications() bool {
+	for file := range s {
+		if isReplicationFile(file) || filepath.Ext(file) == ".zip" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s snapshot) equal(other snapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+
+	for file, state := range s {
+		otherState, ok := other[file]
+		if !ok || otherState.size != state.size || !otherState.modTime.Equal(state.modTime) {
+			return false
+		}
+	}
+	return true
+}
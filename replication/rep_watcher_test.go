@@ -0,0 +1,176 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// newTestLog returns the logger writing to the log directory of a temporary working directory
+func newTestLog(t *testing.T) *logger.Log {
+	t.Helper()
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger("Test")
+	// the message makes Close wait until the log file is opened in the temporary directory
+	log.Info("Test ", t.Name(), " started")
+	t.Cleanup(func() {
+		log.Close()
+		os.Chdir(workDir)
+	})
+	return log
+}
+
+// fakeInstall counts installations and returns errors in order, then nil
+type fakeInstall struct {
+	calls int
+	errs  []error
+}
+
+func (f *fakeInstall) install(ctx context.Context) error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+var watchStart = time.Date(2024, time.June, 15, 2, 0, 0, 0, time.UTC)
+
+func newTestWatcher(t *testing.T) *Watcher {
+	w := NewWatcher(nil, time.Second, time.Minute, nil, newTestLog(t))
+	w.Retry.Jitter = 0
+	return w
+}
+
+func files(sizes map[string]int64) snapshot {
+	result := snapshot{}
+	for name, size := range sizes {
+		result[name] = fileState{size, watchStart}
+	}
+	return result
+}
+
+func TestWatcherWaitsUntilFilesStopChanging(t *testing.T) {
+	w := newTestWatcher(t)
+	installer := &fakeInstall{}
+	state := &watchState{}
+	check := func(current snapshot, after time.Duration) {
+		w.check(context.Background(), state, current, nil, watchStart.Add(after), installer.install)
+	}
+
+	check(files(map[string]int64{"0001.rep": 10}), 0)
+	check(files(map[string]int64{"0001.rep": 10}), 30*time.Second)
+	if installer.calls != 0 {
+		t.Fatalf("installed %d times before the settle time", installer.calls)
+	}
+
+	// the file is still being copied, so the settle time starts again
+	check(files(map[string]int64{"0001.rep": 20}), 50*time.Second)
+	check(files(map[string]int64{"0001.rep": 20}), 90*time.Second)
+	if installer.calls != 0 {
+		t.Fatalf("installed %d times after the file changed", installer.calls)
+	}
+
+	check(files(map[string]int64{"0001.rep": 20}), 110*time.Second)
+	if installer.calls != 1 {
+		t.Fatalf("installed %d times after the settle time, want 1", installer.calls)
+	}
+}
+
+func TestWatcherIgnoresDirectoryWithoutReplications(t *testing.T) {
+	w := newTestWatcher(t)
+	installer := &fakeInstall{}
+	state := &watchState{}
+
+	for _, after := range []time.Duration{0, time.Hour} {
+		w.check(context.Background(), state, files(map[string]int64{"0001.desc": 10}), nil,
+			watchStart.Add(after), installer.install)
+	}
+	w.check(context.Background(), state, nil, errors.New("access denied"), watchStart.Add(2*time.Hour),
+		installer.install)
+
+	if installer.calls != 0 {
+		t.Errorf("installed %d times without replication files", installer.calls)
+	}
+}
+
+func TestWatcherDoesNotRepeatFailedInstallationUntilFilesChange(t *testing.T) {
+	w := newTestWatcher(t)
+	installer := &fakeInstall{errs: []error{errors.New("import failed")}}
+	state := &watchState{}
+	check := func(current snapshot, after time.Duration) {
+		w.check(context.Background(), state, current, nil, watchStart.Add(after), installer.install)
+	}
+
+	current := files(map[string]int64{"0001.rep": 10})
+	check(current, 0)
+	check(current, time.Minute)
+	check(current, time.Hour)
+	if installer.calls != 1 {
+		t.Fatalf("installed %d times, want 1 failed installation", installer.calls)
+	}
+
+	fixed := files(map[string]int64{"0001.rep": 11})
+	check(fixed, time.Hour+time.Second)
+	check(fixed, 2*time.Hour)
+	if installer.calls != 2 {
+		t.Errorf("installed %d times, want the changed files installed again", installer.calls)
+	}
+}
+
+func TestWatcherRetriesTransientFailuresWithBackoff(t *testing.T) {
+	w := newTestWatcher(t)
+	transient := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	installer := &fakeInstall{errs: []error{transient, transient, transient, transient, transient, transient}}
+	state := &watchState{}
+	current := files(map[string]int64{"0001.rep": 10})
+
+	var attempts []time.Duration
+	for after := time.Duration(0); after <= 3*time.Hour; after += 10 * time.Second {
+		calls := installer.calls
+		w.check(context.Background(), state, current, nil, watchStart.Add(after), installer.install)
+		if installer.calls > calls {
+			attempts = append(attempts, after)
+		}
+	}
+
+	// the settle time, then delays of 1, 2, 4 and 8 minutes and no more attempts
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute}
+	if len(attempts) != len(want) {
+		t.Fatalf("attempts at %v, want %v", attempts, want)
+	}
+	for i := range want {
+		if attempts[i] != want[i] {
+			t.Errorf("attempt %d at %v, want %v", i+1, attempts[i], want[i])
+		}
+	}
+}
+
+func TestWatcherRepeatsPostponedInstallation(t *testing.T) {
+	w := newTestWatcher(t)
+	installer := &fakeInstall{errs: []error{&PostponedError{Until: watchStart.Add(time.Hour)}}}
+	state := &watchState{}
+	current := files(map[string]int64{"0001.rep": 10})
+
+	for _, after := range []time.Duration{0, time.Minute, 30 * time.Minute, time.Hour + time.Second} {
+		w.check(context.Background(), state, current, nil, watchStart.Add(after), installer.install)
+	}
+	if installer.calls != 2 {
+		t.Errorf("installed %d times, want the postponed installation repeated once", installer.calls)
+	}
+}
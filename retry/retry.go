@@ -0,0 +1,133 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+func init() {
+	// jitter has to differ between runs started at once
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Classifier returns true if the error is transient and the operation may be repeated
+type Classifier func(err error) bool
+
+// Policy describes how a failed operation is repeated.
+// The delay before the next attempt grows exponentially and is jittered,
+// so parallel runs don't hit the same server at once.
+type Policy struct {
+	// Name of the operation in the log
+	Name        string
+	MaxAttempts int
+	// InitialDelay is the delay before the second attempt
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the fraction of the delay it's randomly changed by, from 0 to 1
+	Jitter float64
+	// Retryable classifies errors, Transient is used if it isn't set
+	Retryable Classifier
+}
+
+// NewPolicy is a constructor for Policy with default delays:
+// 3 attempts, starting from 1 second and doubling up to 30 seconds with 20% jitter
+func NewPolicy(name string, retryable Classifier) Policy {
+	return Policy{
+		Name:         name,
+		MaxAttempts:  3,
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+		Retryable:    retryable,
+	}
+}
+
+// Do runs the operation until it succeeds, returns an error which isn't retryable
+// or the attempts are exhausted. Every attempt is logged.
+// Waiting for the next attempt is aborted if the context is cancelled.
+func (p Policy) Do(ctx context.Context, log *logger.Log, operation func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = Transient
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		log.Info(p.Name, ": attempt ", attempt, " of ", attempts)
+		err = operation(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !retryable(err) {
+			log.Info(p.Name, ": attempt ", attempt, " failed, the error isn't transient: ", err)
+			return err
+		}
+		if attempt == attempts {
+			log.Info(p.Name, ": attempt ", attempt, " failed, no attempts left: ", err)
+			break
+		}
+
+		delay := p.Delay(attempt)
+		log.Info(p.Name, ": attempt ", attempt, " failed, next attempt in ", delay.Round(time.Millisecond), ": ", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+// Delay returns the jittered delay after the attempt
+func (p Policy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Transient returns true for network errors which usually pass by themselves:
+// timeouts, refused and reset connections and connections closed in the middle.
+// Errors of operations on sockets are transient, because their codes differ between platforms.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
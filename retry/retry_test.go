@@ -0,0 +1,205 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
+)
+
+// newTestLog returns the logger writing to the log directory of a temporary working directory
+func newTestLog(t *testing.T) *logger.Log {
+	t.Helper()
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger("Test")
+	// the message makes Close wait until the log file is opened in the temporary directory
+	log.Info("Test ", t.Name(), " started")
+	t.Cleanup(func() {
+		log.Close()
+		os.Chdir(workDir)
+	})
+	return log
+}
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+// failing returns the operation failing with errors in order and succeeding after them
+func failing(calls *int, errs ...error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		*calls++
+		if *calls > len(errs) {
+			return nil
+		}
+		return errs[*calls-1]
+	}
+}
+
+func testPolicy() retry.Policy {
+	policy := retry.NewPolicy("Test operation", nil)
+	policy.InitialDelay = time.Millisecond
+	policy.MaxDelay = 5 * time.Millisecond
+	return policy
+}
+
+func TestDoAttempts(t *testing.T) {
+	permanent := errors.New("login failed")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds at once", nil, 1, nil},
+		{"succeeds after transient errors", []error{errRefused, io.EOF}, 3, nil},
+		{"attempts are exhausted", []error{errRefused, errRefused, io.ErrUnexpectedEOF, nil}, 3, io.ErrUnexpectedEOF},
+		{"error isn't transient", []error{errRefused, permanent}, 2, permanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := testPolicy().Do(context.Background(), newTestLog(t), failing(&calls, tt.errs...))
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("attempts = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoUsesClassifier(t *testing.T) {
+	busy := errors.New("the server is busy")
+	policy := testPolicy()
+	policy.Retryable = func(err error) bool { return errors.Is(err, busy) }
+
+	calls := 0
+	err := policy.Do(context.Background(), newTestLog(t), failing(&calls, busy, errRefused))
+	if !errors.Is(err, errRefused) || calls != 2 {
+		t.Errorf("Do() = %v after %d attempts, want the error out of the classifier after 2", err, calls)
+	}
+}
+
+func TestDoRunsOnceWithoutAttempts(t *testing.T) {
+	policy := testPolicy()
+	policy.MaxAttempts = 0
+
+	calls := 0
+	err := policy.Do(context.Background(), newTestLog(t), failing(&calls, errRefused))
+	if !errors.Is(err, errRefused) || calls != 1 {
+		t.Errorf("Do() = %v after %d attempts, want one attempt", err, calls)
+	}
+}
+
+func TestDoStopsWhenContextIsCancelled(t *testing.T) {
+	log := newTestLog(t)
+	policy := testPolicy()
+	policy.InitialDelay, policy.MaxDelay = time.Hour, time.Hour
+
+	t.Run("while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		calls := 0
+		started := time.Now()
+		err := policy.Do(ctx, log, failing(&calls, errRefused, errRefused))
+		if !errors.Is(err, errRefused) || calls != 1 {
+			t.Errorf("Do() = %v after %d attempts, want the error of the first attempt", err, calls)
+		}
+		if elapsed := time.Since(started); elapsed > 10*time.Second {
+			t.Errorf("Do() waited %v after the context was cancelled", elapsed)
+		}
+	})
+
+	t.Run("during the attempt", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := policy.Do(ctx, log, func(ctx context.Context) error {
+			calls++
+			cancel()
+			return errRefused
+		})
+		if !errors.Is(err, errRefused) || calls != 1 {
+			t.Errorf("Do() = %v after %d attempts, want one attempt", err, calls)
+		}
+	})
+}
+
+func TestDelay(t *testing.T) {
+	policy := retry.NewPolicy("Test operation", nil)
+	base := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		16 * time.Second, 30 * time.Second, 30 * time.Second}
+
+	for attempt, want := range base {
+		for i := 0; i < 100; i++ {
+			delay := policy.Delay(attempt + 1)
+			low, high := time.Duration(float64(want)*0.8), time.Duration(float64(want)*1.2)
+			if delay < low || delay > high {
+				t.Fatalf("Delay(%d) = %v, want between %v and %v", attempt+1, delay, low, high)
+			}
+		}
+	}
+
+	policy.Jitter = 0
+	for attempt, want := range base {
+		if got := policy.Delay(attempt + 1); got != want {
+			t.Errorf("Delay(%d) without jitter = %v, want %v", attempt+1, got, want)
+		}
+	}
+
+	// the multiplier less than 1 keeps the delay constant
+	policy.Multiplier = 0
+	if got := policy.Delay(4); got != time.Second {
+		t.Errorf("Delay(4) with multiplier 0 = %v, want %v", got, time.Second)
+	}
+}
+
+// timeoutError is a net.Error which is a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("login failed"), false},
+		{"cancelled", context.Canceled, false},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"timeout", fmt.Errorf("read: %w", timeoutError{}), true},
+		{"refused connection", errRefused, true},
+		{"temporary DNS error", &net.DNSError{Err: "server misbehaving", IsTemporary: true}, true},
+		{"unknown host", &net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{"closed connection", fmt.Errorf("read packet: %w", io.EOF), true},
+		{"connection closed in the middle", io.ErrUnexpectedEOF, true},
+	}
+
+	for _, tt := range tests {
+		if got := retry.Transient(tt.err); got != tt.want {
+			t.Errorf("Transient(%s) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
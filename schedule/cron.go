@@ -0,0 +1,176 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field is a set of allowed values of a cron field stored as bits
+type field uint64
+
+type fieldRange struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = fieldRange{"minute", 0, 59, nil}
+	hours   = fieldRange{"hour", 0, 23, nil}
+	days    = fieldRange{"day of month", 1, 31, nil}
+	months  = fieldRange{"month", 1, 12, map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// 7 is accepted as Sunday as well as 0
+	weekdays = fieldRange{"day of week", 0, 7, map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+// Expression is a cron expression of five fields:
+// minute, hour, day of month, month and day of week.
+// Fields support *, lists, ranges, steps and names of months and days, e.g. "0 2 * * SAT".
+type Expression struct {
+	source                            string
+	minute, hour, day, month, weekday field
+	anyDay, anyWeekday                bool
+}
+
+// ParseExpression parses the cron expression
+func ParseExpression(expression string) (*Expression, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, but has %d", expression, len(fields))
+	}
+
+	e := &Expression{source: expression}
+	var err error
+	parsers := []struct {
+		target *field
+		value  string
+		rng    fieldRange
+	}{
+		{&e.minute, fields[0], minutes},
+		{&e.hour, fields[1], hours},
+		{&e.day, fields[2], days},
+		{&e.month, fields[3], months},
+		{&e.weekday, fields[4], weekdays},
+	}
+	for _, p := range parsers {
+		*p.target, err = parseField(p.value, p.rng)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expression, err)
+		}
+	}
+
+	// Sunday may be set as 7
+	if e.weekday&(1<<7) != 0 {
+		e.weekday |= 1
+	}
+	e.anyDay = fields[2] == "*"
+	e.anyWeekday = fields[4] == "*"
+
+	return e, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Match returns true if the time matches the expression with a minute precision
+func (e *Expression) Match(t time.Time) bool {
+	if !e.minute.has(t.Minute()) || !e.hour.has(t.Hour()) || !e.month.has(int(t.Month())) {
+		return false
+	}
+
+	day := e.day.has(t.Day())
+	weekday := e.weekday.has(int(t.Weekday()))
+
+	// as in cron, if both days are restricted the time matches either of them
+	switch {
+	case e.anyDay && e.anyWeekday:
+		return true
+	case e.anyDay:
+		return weekday
+	case e.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func (f field) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+func parseField(value string, rng fieldRange) (field, error) {
+	var result field
+
+	for _, part := range strings.Split(value, ",") {
+		bits, err := parsePart(part, rng)
+		if err != nil {
+			return 0, err
+		}
+		result |= bits
+	}
+
+	return result, nil
+}
+
+// parsePart parses *, a value, a range "a-b" with an optional step "/n"
+func parsePart(part string, rng fieldRange) (field, error) {
+	step := 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		s, err := strconv.Atoi(part[i+1:])
+		if err != nil || s <= 0 {
+			return 0, fmt.Errorf("invalid step in %s field %q", rng.name, part)
+		}
+		step = s
+		part = part[:i]
+	}
+
+	low, high := rng.min, rng.max
+	if part != "*" {
+		bounds := strings.SplitN(part, "-", 2)
+		var err error
+		low, err = parseValue(bounds[0], rng)
+		if err != nil {
+			return 0, err
+		}
+
+		high = low
+		if len(bounds) == 2 {
+			high, err = parseValue(bounds[1], rng)
+			if err != nil {
+				return 0, err
+			}
+		} else if step > 1 {
+			high = rng.max
+		}
+	}
+
+	if low > high {
+		return 0, fmt.Errorf("invalid range in %s field %q", rng.name, part)
+	}
+
+	var result field
+	for v := low; v <= high; v += step {
+		result |= 1 << uint(v)
+	}
+	return result, nil
+}
+
+func parseValue(value string, rng fieldRange) (int, error) {
+	if v, ok := rng.names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < rng.min || v > rng.max {
+		return 0, fmt.Errorf("invalid value %q of %s field, expected %d-%d", value, rng.name, rng.min, rng.max)
+	}
+	return v, nil
+}
@@ -0,0 +1,122 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func bits(values ...int) field {
+	var result field
+	for _, v := range values {
+		result |= 1 << uint(v)
+	}
+	return result
+}
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		value string
+		rng   fieldRange
+		want  field
+	}{
+		{"5", minutes, bits(5)},
+		{"*", hours, bits(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23)},
+		{"1-5", days, bits(1, 2, 3, 4, 5)},
+		{"*/15", minutes, bits(0, 15, 30, 45)},
+		{"5/20", minutes, bits(5, 25, 45)},
+		{"1-10/3", days, bits(1, 4, 7, 10)},
+		{"1,5-7,10", hours, bits(1, 5, 6, 7, 10)},
+		{"0,30", minutes, bits(0, 30)},
+		{"JAN,jun-AUG", months, bits(1, 6, 7, 8)},
+		{"MON-FRI", weekdays, bits(1, 2, 3, 4, 5)},
+		{"SAT,SUN", weekdays, bits(0, 6)},
+		{"*/2", weekdays, bits(0, 2, 4, 6)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rng.name+" "+tt.value, func(t *testing.T) {
+			got, err := parseField(tt.value, tt.rng)
+			if err != nil {
+				t.Fatalf("parseField(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseField(%q) = %b, want %b", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"-1 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"1-2-3 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1,,2 * * * *",
+		"MON * * * *",
+		"* * * * SATURDAY",
+	}
+
+	for _, expression := range tests {
+		t.Run(expression, func(t *testing.T) {
+			if e, err := ParseExpression(expression); err == nil {
+				t.Errorf("ParseExpression(%q) = %v, want an error", expression, e)
+			}
+		})
+	}
+}
+
+func TestExpressionMatch(t *testing.T) {
+	// 2024-06-15 is Saturday
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.June, day, hour, minute, 30, 0, time.Local)
+	}
+
+	tests := []struct {
+		expression string
+		time       time.Time
+		want       bool
+	}{
+		{"* * * * *", date(15, 13, 7), true},
+		{"0 2 * * SAT", date(15, 2, 0), true},
+		{"0 2 * * SAT", date(15, 2, 1), false},
+		{"0 2 * * SAT", date(16, 2, 0), false},
+		{"0 2 * * 6", date(15, 2, 0), true},
+		{"0 2 * * 7", date(16, 2, 0), true},
+		{"0 2 * * 0", date(16, 2, 0), true},
+		{"*/15 22-23 * * MON-FRI", date(17, 22, 45), true},
+		{"*/15 22-23 * * MON-FRI", date(17, 22, 50), false},
+		{"*/15 22-23 * * MON-FRI", date(15, 22, 45), false},
+		{"30 1 1,15 * *", date(15, 1, 30), true},
+		{"30 1 1,15 * *", date(14, 1, 30), false},
+		{"0 0 * JUL *", date(15, 0, 0), false},
+		{"0 0 * 5-6 *", date(15, 0, 0), true},
+		// as in cron, the time matches either day if both are restricted
+		{"0 3 1 * SAT", date(15, 3, 0), true},
+		{"0 3 1 * SAT", date(1, 3, 0), true},
+		{"0 3 1 * SAT", date(2, 3, 0), false},
+		{"0 3 15 * MON", date(15, 3, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression+" "+tt.time.Format(time.RFC3339), func(t *testing.T) {
+			e, err := ParseExpression(tt.expression)
+			if err != nil {
+				t.Fatalf("ParseExpression(%q) error = %v", tt.expression, err)
+			}
+			if got := e.Match(tt.time); got != tt.want {
+				t.Errorf("Match(%s) = %t, want %t", tt.time.Format(time.RFC1123), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// searchLimit restricts the search of the next window
+const searchLimit = 366 * 24 * time.Hour
+
+// ErrOutsideWindow is returned when the installation is not allowed at the moment
+var ErrOutsideWindow = errors.New("the installation is allowed only in the maintenance window")
+
+// OutsideWindowError is returned when the installation is attempted outside of maintenance windows.
+// Next is zero if no window opens during a year.
+type OutsideWindowError struct {
+	Next time.Time
+}
+
+func (e *OutsideWindowError) Error() string {
+	if e.Next.IsZero() {
+		return fmt.Sprintf("%v, no window opens during a year", ErrOutsideWindow)
+	}
+	return fmt.Sprintf("%v, the next window opens at %s", ErrOutsideWindow, e.Next.Format(time.RFC3339))
+}
+
+// Is allows to check the error by errors.Is(err, ErrOutsideWindow)
+func (e *OutsideWindowError) Is(target error) bool {
+	return target == ErrOutsideWindow
+}
+
+// Schedule is a set of maintenance windows when services may be stopped.
+// Each window opens at times matching its cron expression and lasts the same duration.
+type Schedule struct {
+	windows  []*Expression
+	Duration time.Duration
+}
+
+// New parses cron expressions of maintenance windows.
+// The empty schedule allows the installation at any time.
+func New(expressions []string, duration time.Duration) (*Schedule, error) {
+	s := &Schedule{Duration: duration}
+
+	for _, expression := range expressions {
+		if strings.TrimSpace(expression) == "" {
+			continue
+		}
+
+		window, err := ParseExpression(expression)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, window)
+	}
+
+	if len(s.windows) > 0 && duration < time.Minute {
+		return nil, fmt.Errorf("the duration of maintenance windows must be at least a minute, but it is %v", duration)
+	}
+
+	return s, nil
+}
+
+// IsEmpty returns true if there are no windows, i.e. the installation is always allowed
+func (s *Schedule) IsEmpty() bool {
+	return len(s.windows) == 0
+}
+
+// End returns the end of the window open at the time.
+// If several windows are open, the latest end is returned.
+func (s *Schedule) End(t time.Time) (time.Time, bool) {
+	var end time.Time
+	found := false
+
+	t = t.Truncate(time.Minute)
+	for _, window := range s.windows {
+		for start := t; t.Sub(start) < s.Duration; start = start.Add(-time.Minute) {
+			if window.Match(start) && start.Add(s.Duration).After(end) {
+				end = start.Add(s.Duration)
+				found = true
+			}
+		}
+	}
+
+	return end, found
+}
+
+// Next returns the start of the nearest window after the time
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	limit := t.Add(searchLimit)
+
+	for start := t.Truncate(time.Minute).Add(time.Minute); start.Before(limit); start = start.Add(time.Minute) {
+		for _, window := range s.windows {
+			if window.Match(start) {
+				return start, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Check returns the end of the current window,
+// if at least minRemaining is left before its end.
+// Otherwise OutsideWindowError with the start of the next window is returned.
+func (s *Schedule) Check(t time.Time, minRemaining time.Duration) (time.Time, error) {
+	end, ok := s.End(t)
+	if ok && end.Sub(t) >= minRemaining {
+		return end, nil
+	}
+
+	next, _ := s.Next(t)
+	// the current window is closing, so the next one is looked for after its end
+	if ok {
+		next, _ = s.Next(end)
+	}
+	return time.Time{}, &OutsideWindowError{next}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// DryRunService only reports what would be done with the service
+type DryRunService struct {
+	log         *logger.Log
+	ServiceName string
+}
+
+// NewDryRunService is a constructor to get IService which doesn't touch the real service
+func NewDryRunService(serviceName string, log *logger.Log) IService {
+	return DryRunService{log, serviceName}
+}
+
+// HasService checks the real service, because it doesn't change anything
+func (worker DryRunService) HasService(ctx context.Context) error {
+	return NewService(worker.ServiceName, worker.log).HasService(ctx)
+}
+
+// State isn't queried in dry run mode
+func (worker DryRunService) State(ctx context.Context) (string, error) {
+	return "unknown", nil
+}
+
+// StartService reports that the service would be started
+func (worker DryRunService) StartService(ctx context.Context) error {
+	worker.report("started")
+	return nil
+}
+
+// StopService reports that the service would be stopped
+func (worker DryRunService) StopService(ctx context.Context) error {
+	worker.report("stopped")
+	return nil
+}
+
+func (worker DryRunService) report(action string) {
+	if worker.ServiceName == "" {
+		return
+	}
+	worker.log.Info("[dry run] Service ", worker.ServiceName, " would be ", action)
+}
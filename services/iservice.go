@@ -0,0 +1,11 @@
+package services
+
+import "context"
+
+// IService - base functions for working with services
+type IService interface {
+	HasService(ctx context.Context) error
+	State(ctx context.Context) (string, error)
+	StartService(ctx context.Context) error
+	StopService(ctx context.Context) error
+}
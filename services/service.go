@@ -3,21 +3,27 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 )
 
-type serviceFunc func(*mgr.Service) error
+type serviceFunc func(context.Context, *mgr.Service) error
 
-// IService - base functions for working with services
-type IService interface {
-	HasService() error
-	StartService() error
-	StopService() error
+// transientErrors are errors of the service control manager which pass by themselves,
+// e.g. the service is starting or stopping and can't accept the control yet
+var transientErrors = []windows.Errno{
+	windows.ERROR_SERVICE_REQUEST_TIMEOUT,
+	windows.ERROR_SERVICE_DATABASE_LOCKED,
+	windows.ERROR_SERVICE_CANNOT_ACCEPT_CTRL,
+	windows.RPC_S_SERVER_UNAVAILABLE,
 }
 
 // ServiceWorker is a handler to work with windows services
@@ -34,31 +40,46 @@ func NewService(serviceName string, log *logger.Log) IService {
 // HasService returns true
 // if window already has the service
 // with name presented in ServiceWorker struct
-func (worker ServiceWorker) HasService() error {
-	return worker.serviceAction(worker.hasService)
+func (worker ServiceWorker) HasService(ctx context.Context) error {
+	return worker.serviceAction(ctx, worker.hasService)
 }
 
-func (worker ServiceWorker) hasService(service *mgr.Service) error {
+func (worker ServiceWorker) hasService(ctx context.Context, service *mgr.Service) error {
 	if service != nil {
 		return nil
 	}
 	return fmt.Errorf("service %s does not exist", worker.ServiceName)
 }
 
+// State returns the current state of the service,
+// e.g. Running or Stopped
+func (worker ServiceWorker) State(ctx context.Context) (string, error) {
+	var state string
+	err := worker.serviceAction(ctx, func(ctx context.Context, service *mgr.Service) error {
+		status, err := service.Query()
+		if err != nil {
+			return fmt.Errorf("failed to get service '%s' status: %v", worker.ServiceName, err)
+		}
+		state = states[status.State]
+		return nil
+	})
+	return state, err
+}
+
 // StartService starts the service
 // with name from ServiceWorker struct
-func (worker ServiceWorker) StartService() error {
-	return worker.serviceAction(worker.startService)
+func (worker ServiceWorker) StartService(ctx context.Context) error {
+	return worker.serviceAction(ctx, worker.startService)
 }
 
-func (worker ServiceWorker) startService(service *mgr.Service) error {
+func (worker ServiceWorker) startService(ctx context.Context, service *mgr.Service) error {
 	if worker.hasServiceStatus(service, svc.Stopped) {
 		err := service.Start()
 		if err != nil {
-			return fmt.Errorf("Could not start the service: %v", err)
+			return fmt.Errorf("Could not start the service: %w", err)
 		}
 
-		status, err := worker.waitingForState(service, svc.Running)
+		status, err := worker.waitingForState(ctx, service, svc.Running)
 		if err != nil {
 			return fmt.Errorf("Failed to stop service %s, status: %v", worker.ServiceName, states[status.State])
 		}
@@ -71,18 +92,18 @@ func (worker ServiceWorker) startService(service *mgr.Service) error {
 
 // StopService stops the service
 // with name from ServiceWorker struct
-func (worker ServiceWorker) StopService() error {
-	return worker.serviceAction(worker.stopService)
+func (worker ServiceWorker) StopService(ctx context.Context) error {
+	return worker.serviceAction(ctx, worker.stopService)
 }
 
-func (worker ServiceWorker) stopService(service *mgr.Service) error {
+func (worker ServiceWorker) stopService(ctx context.Context, service *mgr.Service) error {
 	if worker.hasServiceStatus(service, svc.Running) {
 		status, err := service.Control(svc.Stop)
 		if err != nil {
-			return fmt.Errorf("Could not stop the service: %v", err)
+			return fmt.Errorf("Could not stop the service: %w", err)
 		}
 
-		status, err = worker.waitingForState(service, svc.Stopped)
+		status, err = worker.waitingForState(ctx, service, svc.Stopped)
 		if err != nil {
 			return fmt.Errorf("Failed to stop service %s, status: %v", worker.ServiceName, states[status.State])
 		}
@@ -93,33 +114,46 @@ func (worker ServiceWorker) stopService(service *mgr.Service) error {
 	return nil
 }
 
-func (worker ServiceWorker) serviceAction(action serviceFunc) error {
+// serviceAction repeats the action if the service control manager fails with a transient error
+func (worker ServiceWorker) serviceAction(ctx context.Context, action serviceFunc) error {
 	if worker.ServiceName == "" {
 		return nil
 	}
 
-	manager, err := mgr.Connect()
+	policy := retry.NewPolicy("Control of service "+worker.ServiceName, isTransient)
+	err := policy.Do(ctx, worker.log, func(ctx context.Context) error {
+		return worker.doServiceAction(ctx, action)
+	})
 	if err != nil {
-		err = fmt.Errorf("Cannot connect to manager %v", err)
 		worker.log.Error(err)
-		return err
+	}
+
+	return err
+}
+
+func (worker ServiceWorker) doServiceAction(ctx context.Context, action serviceFunc) error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Cannot connect to manager %w", err)
 	}
 	defer manager.Disconnect()
 
 	service, err := manager.OpenService(worker.ServiceName)
 	if err != nil {
-		err = fmt.Errorf("Service '%s' does not exist: %v", worker.ServiceName, err)
-		worker.log.Error(err)
-		return err
+		return fmt.Errorf("Service '%s' does not exist: %w", worker.ServiceName, err)
 	}
 	defer service.Close()
 
-	err = action(service)
-	if err != nil {
-		worker.log.Error(err)
-	}
+	return action(ctx, service)
+}
 
-	return err
+func isTransient(err error) bool {
+	for _, code := range transientErrors {
+		if errors.Is(err, code) {
+			return true
+		}
+	}
+	return false
 }
 
 func (worker ServiceWorker) hasServiceStatus(service *mgr.Service, state svc.State) bool {
@@ -133,13 +167,17 @@ func (worker ServiceWorker) hasServiceStatus(service *mgr.Service, state svc.Sta
 	return status.State == state
 }
 
-func (worker ServiceWorker) waitingForState(service *mgr.Service, state svc.State) (svc.Status, error) {
+func (worker ServiceWorker) waitingForState(ctx context.Context, service *mgr.Service, state svc.State) (svc.Status, error) {
 	start := time.Now()
 
 	var status svc.Status
 	var err error
 
 	for 600*time.Second > time.Since(start) {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
 		status, err = service.Query()
 		if err != nil {
 			err = fmt.Errorf("failed to get service '%s' status: %v", worker.ServiceName, err)
@@ -150,6 +188,11 @@ func (worker ServiceWorker) waitingForState(service *mgr.Service, state svc.Stat
 		if status.State == state {
 			break
 		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(300 * time.Millisecond):
+		}
 	}
 
 	return status, err
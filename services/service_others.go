@@ -0,0 +1,176 @@
+// +build !windows
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+	"github.com/sergeyzalunin/go-replication-loader/retry"
+)
+
+const (
+	stateRunning = "Running"
+	stateStopped = "Stopped"
+)
+
+// states maps ActiveState of systemd units to the names of windows service states,
+// so both platforms report states the same way
+var states = map[string]string{
+	"active":       stateRunning,
+	"reloading":    stateRunning,
+	"inactive":     stateStopped,
+	"failed":       stateStopped,
+	"activating":   "StartPending",
+	"deactivating": "StopPending",
+}
+
+// transientErrors are messages of systemctl which pass by themselves,
+// e.g. systemd is being reloaded and doesn't answer yet
+var transientErrors = []string{
+	"Failed to connect to bus",
+	"Connection timed out",
+	"Transport endpoint is not connected",
+}
+
+// runner runs systemctl with the arguments and returns its output
+type runner func(ctx context.Context, args ...string) (string, error)
+
+// ServiceWorker is a handler to work with systemd units by systemctl
+type ServiceWorker struct {
+	log         *logger.Log
+	ServiceName string
+	// run is replaced in tests, so systemd isn't required
+	run runner
+}
+
+// NewService is a constructor to get IService
+func NewService(serviceName string, log *logger.Log) IService {
+	return ServiceWorker{log, serviceName, runSystemctl}
+}
+
+// HasService returns nil
+// if systemd has the unit
+// with name presented in ServiceWorker struct
+func (worker ServiceWorker) HasService(ctx context.Context) error {
+	if worker.ServiceName == "" {
+		return nil
+	}
+
+	loadState, err := worker.property(ctx, "LoadState")
+	if err != nil {
+		return err
+	}
+	if loadState == "not-found" {
+		err = fmt.Errorf("service %s does not exist", worker.ServiceName)
+		worker.log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// State returns the current state of the service,
+// e.g. Running or Stopped
+func (worker ServiceWorker) State(ctx context.Context) (string, error) {
+	if worker.ServiceName == "" {
+		return "", nil
+	}
+
+	activeState, err := worker.property(ctx, "ActiveState")
+	if err != nil {
+		return "", err
+	}
+	if state, ok := states[activeState]; ok {
+		return state, nil
+	}
+	return activeState, nil
+}
+
+// StartService starts the service
+// with name from ServiceWorker struct.
+// systemctl waits until the unit is started.
+func (worker ServiceWorker) StartService(ctx context.Context) error {
+	return worker.control(ctx, "start", stateStopped, "started")
+}
+
+// StopService stops the service
+// with name from ServiceWorker struct.
+// systemctl waits until the unit is stopped.
+func (worker ServiceWorker) StopService(ctx context.Context) error {
+	return worker.control(ctx, "stop", stateRunning, "stopped")
+}
+
+// control runs the command of systemctl if the service is in the state
+func (worker ServiceWorker) control(ctx context.Context, command, state, result string) error {
+	if worker.ServiceName == "" {
+		return nil
+	}
+
+	current, err := worker.State(ctx)
+	if err != nil {
+		return err
+	}
+	worker.log.Info("Service ", worker.ServiceName, " state is ", current)
+	if current != state {
+		return nil
+	}
+
+	if _, err = worker.systemctl(ctx, command, worker.ServiceName); err != nil {
+		return err
+	}
+
+	current, err = worker.State(ctx)
+	if err != nil {
+		return err
+	}
+	worker.log.Info("Service ", worker.ServiceName, " is already ", result, ", final state: ", current)
+	return nil
+}
+
+func (worker ServiceWorker) property(ctx context.Context, name string) (string, error) {
+	output, err := worker.systemctl(ctx, "show", "--property="+name, worker.ServiceName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(output), name+"="), nil
+}
+
+// systemctl runs the command and repeats it if systemd fails with a transient error
+func (worker ServiceWorker) systemctl(ctx context.Context, args ...string) (string, error) {
+	var output string
+	policy := retry.NewPolicy("Control of service "+worker.ServiceName, isTransient)
+	err := policy.Do(ctx, worker.log, func(ctx context.Context) error {
+		var err error
+		output, err = worker.run(ctx, args...)
+		return err
+	})
+	if err != nil {
+		worker.log.Error(err)
+	}
+	return output, err
+}
+
+func runSystemctl(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "systemctl", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("systemctl %s failed: %w: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func isTransient(err error) bool {
+	for _, msg := range transientErrors {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
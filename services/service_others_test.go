@@ -0,0 +1,183 @@
+// +build !windows
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergeyzalunin/go-replication-loader/logger"
+)
+
+// newTestLog returns the logger writing to the log directory of a temporary working directory
+func newTestLog(t *testing.T) *logger.Log {
+	t.Helper()
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger("Test")
+	// the message makes Close wait until the log file is opened in the temporary directory
+	log.Info("Test ", t.Name(), " started")
+	t.Cleanup(func() {
+		log.Close()
+		os.Chdir(workDir)
+	})
+	return log
+}
+
+// fakeSystemctl answers commands by the output of systemctl and records them
+type fakeSystemctl struct {
+	outputs  map[string]string
+	errs     map[string]error
+	commands []string
+}
+
+func (f *fakeSystemctl) run(ctx context.Context, args ...string) (string, error) {
+	command := strings.Join(args, " ")
+	f.commands = append(f.commands, command)
+	if err := f.errs[command]; err != nil {
+		return "", err
+	}
+	return f.outputs[command], nil
+}
+
+func newTestWorker(t *testing.T, systemctl *fakeSystemctl) ServiceWorker {
+	return ServiceWorker{newTestLog(t), "eleed.service", systemctl.run}
+}
+
+func TestHasService(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		err     error
+		wantErr string
+	}{
+		{"loaded", "LoadState=loaded\n", nil, ""},
+		{"not found", "LoadState=not-found\n", nil, "service eleed.service does not exist"},
+		{"systemctl failed", "", errors.New("systemctl show failed: exit status 1"), "exit status 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			systemctl := &fakeSystemctl{
+				outputs: map[string]string{"show --property=LoadState eleed.service": tt.output},
+				errs:    map[string]error{"show --property=LoadState eleed.service": tt.err},
+			}
+
+			err := newTestWorker(t, systemctl).HasService(context.Background())
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("HasService() error = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("HasService() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"ActiveState=active\n", stateRunning},
+		{"ActiveState=reloading\n", stateRunning},
+		{"ActiveState=inactive\n", stateStopped},
+		{"ActiveState=failed", stateStopped},
+		{"ActiveState=activating\n", "StartPending"},
+		{"ActiveState=deactivating\n", "StopPending"},
+		// unknown states are returned as systemd reports them
+		{"ActiveState=maintenance\n", "maintenance"},
+	}
+
+	for _, tt := range tests {
+		systemctl := &fakeSystemctl{outputs: map[string]string{"show --property=ActiveState eleed.service": tt.output}}
+		got, err := newTestWorker(t, systemctl).State(context.Background())
+		if err != nil || got != tt.want {
+			t.Errorf("State() of %q = %q, %v, want %q", tt.output, got, err, tt.want)
+		}
+	}
+}
+
+func TestControlRunsCommandOnlyInState(t *testing.T) {
+	const show = "show --property=ActiveState eleed.service"
+
+	tests := []struct {
+		name    string
+		stop    bool
+		state   string
+		command string
+	}{
+		{"start stopped", false, "inactive", "start eleed.service"},
+		{"start running", false, "active", ""},
+		{"stop running", true, "active", "stop eleed.service"},
+		{"stop stopped", true, "failed", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			systemctl := &fakeSystemctl{outputs: map[string]string{show: "ActiveState=" + tt.state}}
+			worker := newTestWorker(t, systemctl)
+
+			var err error
+			if tt.stop {
+				err = worker.StopService(context.Background())
+			} else {
+				err = worker.StartService(context.Background())
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{show}
+			if tt.command != "" {
+				want = append(want, tt.command, show)
+			}
+			if !reflect.DeepEqual(systemctl.commands, want) {
+				t.Errorf("commands = %q, want %q", systemctl.commands, want)
+			}
+		})
+	}
+}
+
+func TestServiceWithoutNameIsSkipped(t *testing.T) {
+	systemctl := &fakeSystemctl{}
+	worker := ServiceWorker{newTestLog(t), "", systemctl.run}
+
+	if err := worker.HasService(context.Background()); err != nil {
+		t.Errorf("HasService() error = %v", err)
+	}
+	if err := worker.StopService(context.Background()); err != nil {
+		t.Errorf("StopService() error = %v", err)
+	}
+	if len(systemctl.commands) != 0 {
+		t.Errorf("commands = %q, want none", systemctl.commands)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{"systemctl show failed: exit status 1: Failed to connect to bus: No such file or directory", true},
+		{"systemctl start failed: exit status 1: Connection timed out", true},
+		{"systemctl stop failed: exit status 5: Unit eleed.service not loaded.", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransient(errors.New(tt.err)); got != tt.want {
+			t.Errorf("isTransient(%q) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}